@@ -4,13 +4,20 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
-	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/dustin/go-humanize"
 
 	"pgbackup"
 	"pgbackup/logger"
@@ -21,12 +28,20 @@ import (
 // Files is the application files.
 type Files struct {
 	Binary string
+	// Conf is the configuration file.
+	Conf string
+	// Lock is the lock file held in the backups directory by commands that modify it.
+	Lock string
+	// History is the file -drill appends its outcomes to.
+	History string
 }
 
 // Paths is the application paths.
 type Paths struct {
 	Home    string
 	Backups string
+	// PreRestore is where safety backups are taken before a restore replaces a database.
+	PreRestore string
 }
 
 // App is the application.
@@ -47,6 +62,11 @@ type App struct {
 	Jobs int
 	//
 	Ctx context.Context
+	// Report collects the outcome of work on each database.
+	Report Report
+	// The signal that interrupted the application, if any.
+	signal atomic.Value
+	//
 	logger.Logger
 }
 
@@ -59,45 +79,126 @@ func (app *App) Run() {
 	//
 	app.CPUs, app.Ops, app.Jobs = pgbackup.CalcConcurrency()
 	//
-	err = os.MkdirAll(app.Paths.Backups, 0770)
-	app.Error(err)
+	if !app.Conf.DryRun {
+		err = os.MkdirAll(app.Paths.Backups, 0770)
+		app.Error(err)
+	}
 	//
 	app.PSQL = psql.PSQL{
-		DirBackups: app.Paths.Backups,
-		Jobs:       app.Jobs,
-		Logger:     logger.Nil,
+		DirBackups:    app.Paths.Backups,
+		Conn:          app.Conf.CloneTo,
+		Jobs:          app.Jobs,
+		Binaries:      app.Conf.Binaries,
+		DataStyle:     app.Conf.DataStyle,
+		RowsPerInsert: app.Conf.RowsPerInsert,
+		Retry:         app.Conf.Retry,
+		DryRun:        app.Conf.DryRun,
+		Terminate:     app.Conf.Terminate,
+		Filter:        app.Conf.Filter,
+		ListFile:      app.Conf.ListFile,
+		NoOwner:       app.Conf.NoOwner,
+		NoPrivileges:  app.Conf.NoPrivileges,
+		Roles:         app.Conf.Roles,
+		Notices:       app.Logger,
+		Logger:        logger.Nil,
 	}
-	if app.Args.Verbose {
+	app.PSQL.Retry.Logger = app.Logger
+	if app.Args.Verbose || app.Conf.DryRun {
 		app.PSQL.Logger = app.Logger
 	}
-	//
-	// SIGINT
-	go func() {
-		sigCh := make(chan os.Signal, 8)
-		signal.Notify(sigCh, os.Interrupt)
-		for {
-			select {
-			case <-sigCh:
-				cancelCtx()
-				return
-			case <-app.Ctx.Done():
-				return
-			}
+	// Binaries set explicitly apply to every command; the bin directory for the version of the
+	// server is only looked up for the commands that work with databases on it.
+	if app.Args.Backup || app.Args.Restore || app.Args.Drill || app.Args.Clone || app.Args.DiffSchema {
+		server := "database"
+		if app.Args.Clone {
+			server = "destination"
 		}
-	}()
+		app.ResolveBinaries(app.Ctx, &app.PSQL, server)
+	}
+	//
+	// SIGINT, SIGTERM, SIGHUP
+	sigCh := make(chan os.Signal, 8)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigCh)
+	go app.Signals(sigCh, cancelCtx)
+	//
+	if (app.Args.Backup || app.Args.Restore || app.Args.Drill || app.Args.Clear) && !app.Conf.DryRun {
+		lock, err := app.Lock()
+		app.Error(err)
+		defer lock.Unlock()
+	}
 	//
 	switch true {
 	case app.Args.Backup:
 		app.ExecBackup()
 	case app.Args.Restore:
 		app.ExecRestore()
+	case app.Args.Drill:
+		app.ExecDrill()
+	case app.Args.Clone:
+		app.ExecClone()
 	case app.Args.Clear:
 		app.ExecClear()
+	case app.Args.Inspect:
+		app.ExecInspect()
+	case app.Args.DiffSchema:
+		app.ExecDiffSchema()
 	case app.Args.List:
 		app.ExecList()
 	case app.Args.Version:
 		app.ExecVersion()
 	}
+	//
+	if sig, ok := app.signal.Load().(syscall.Signal); ok {
+		app.Errorf("Interrupted by %v", sig)
+		os.Exit(128 + int(sig))
+	}
+}
+
+// Lock takes the lock on the backups directory; if another process holds it Lock waits up
+// to -wait-lock for it to be released.
+func (app *App) Lock() (*pgbackup.LockFile, error) {
+	if app.Conf.WaitLock > 0 {
+		app.Infof("Waiting up to %v for %v", app.Conf.WaitLock, app.Files.Lock)
+	}
+	lock, err := pgbackup.Lock(app.Ctx, app.Files.Lock, app.Conf.WaitLock)
+	var locked *pgbackup.LockedError
+	if errors.As(err, &locked) {
+		return nil, fmt.Errorf("%w; another %v may be running", err, app.Files.Binary)
+	}
+	return lock, err
+}
+
+// Signals cancels app.Ctx when the first signal arrives on sigCh so running commands are killed
+// and no further work is started.  Workers are given the -grace period to finish cleaning up; the
+// process exits when the grace period expires or a second signal arrives.
+func (app *App) Signals(sigCh chan os.Signal, cancelCtx func()) {
+	var sig os.Signal
+	select {
+	case sig = <-sigCh:
+	case <-app.Ctx.Done():
+		return
+	}
+	if s, ok := sig.(syscall.Signal); ok {
+		app.signal.Store(s)
+	}
+	app.Warningf("Received %v; stopping after cleanup (send again to exit immediately)", sig)
+	if running := app.Report.Running(); len(running) > 0 {
+		app.Warningf("\tInterrupting: %v", strings.Join(running, ", "))
+	}
+	cancelCtx()
+	//
+	timer := time.NewTimer(app.Conf.Grace)
+	select {
+	case sig = <-sigCh:
+		app.Errorf("Received %v; exiting immediately", sig)
+	case <-timer.C:
+		app.Errorf("Grace period of %v expired; exiting", app.Conf.Grace)
+	}
+	if running := app.Report.Running(); len(running) > 0 {
+		app.Errorf("\tStill running: %v", strings.Join(running, ", "))
+	}
+	os.Exit(255)
 }
 
 // Error exits the application if err is non-nil.
@@ -112,8 +213,8 @@ func (app *App) Error(err error) {
 func (app *App) GetList() []string {
 	var rv []string
 	//
-	cmd := exec.Command("psql", "-l")
-	if app.Args.Verbose {
+	cmd := exec.Command(app.PSQL.Binary("psql"), "-l")
+	if app.Args.Verbose || app.Conf.DryRun {
 		app.Infof(strings.Join(cmd.Args, " "))
 	}
 	//
@@ -156,7 +257,6 @@ func (app *App) ExecBackup() {
 	app.Summarize()
 	//
 	var dbs []string
-	var dbsCh chan string
 	if len(app.Args.Remaining) > 0 {
 		// Explicitly named databases...
 		dbs = append([]string(nil), app.Args.Remaining...)
@@ -168,52 +268,55 @@ func (app *App) ExecBackup() {
 		// All dbs
 		dbs = app.GetList()
 	}
-	dbsCh = make(chan string, len(dbs))
-	for _, db := range dbs {
-		dbsCh <- db
-	}
-	close(dbsCh)
-	//
-	var wg sync.WaitGroup
-	for k := 0; k < app.Ops; k++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			var dst string
-			var err error
-			//
-			for {
-				select {
-				case dbname, ok := <-dbsCh:
-					if !ok {
-						return
-					}
-					app.Infof("Starting %v...", dbname)
-					db := psql.DB{
-						DBName: dbname,
-						PSQL:   app.PSQL,
-					}
-					if dst, err = db.Backup(app.Ctx, app.Conf.Format); err != nil {
-						app.Warningf("Backing up %v failed: %v", dbname, err)
-						continue
-					}
-					//
-					if app.Conf.Format == psql.Script && app.Conf.SplitSize > 0 {
-						if err = db.Chunk(dst, app.Conf.SplitSize); err != nil {
-							app.Warningf("Split %v failed: %v", dbname, err)
-							continue
-						}
-					}
-					//
-					app.Infof("Finished %v", dbname)
-
-				case <-app.Ctx.Done():
-					return
-				}
+	app.Plan(dbs)
+	app.Work(dbs, func(ctx context.Context, dbname string) error {
+		app.Infof("Starting %v...", dbname)
+		settings := app.SettingsFor(dbname)
+		db := psql.DB{
+			DBName: dbname,
+			PSQL:   app.PSQLFor(dbname),
+		}
+		var dst string
+		var snapshot *psql.Snapshot
+		var err error
+		//
+		// With -verify the backup is dumped in the snapshot the counts in its metadata are taken in.
+		if app.Conf.Verify {
+			dst, snapshot, err = db.BackupInSnapshot(ctx, settings.Format)
+		} else {
+			dst, err = db.Backup(ctx, settings.Format)
+		}
+		if err != nil {
+			app.Warningf("Backing up %v failed: %v", dbname, err)
+			return err
+		}
+		//
+		// The metadata is recorded first so the snapshot is released as soon as possible.
+		err = app.RecordMeta(ctx, dbname, snapshot)
+		if snapshot != nil {
+			snapshot.Close()
+		}
+		if err != nil {
+			app.Warningf("Recording metadata for %v failed: %v", dbname, err)
+			return err
+		}
+		//
+		if err = app.MaskBackup(db, settings); err != nil {
+			app.Warningf("Masking %v failed: %v", dbname, err)
+			return err
+		}
+		//
+		if settings.Format == psql.Script && settings.SplitSize > 0 {
+			if err = db.Chunk(dst, settings.SplitSize); err != nil {
+				app.Warningf("Split %v failed: %v", dbname, err)
+				return err
 			}
-		}()
-	}
-	wg.Wait()
+		}
+		//
+		app.Infof("Finished %v", dbname)
+		return nil
+	})
+	app.Summary()
 }
 
 func (app *App) ExecRestore() {
@@ -223,90 +326,181 @@ func (app *App) ExecRestore() {
 	app.Summarize()
 	//
 	var paths []string
-	var dbsCh chan string
 	//
-	// Source extensions depending on -format & -join flags.
-	ext := ".backup"
-	if app.Conf.Format == psql.Script {
-		ext = ".sql"
-		if app.Args.Join {
-			ext = ".chunk"
+	// source returns the file name of the source of dbname depending on its content, its format
+	// and the -join flag.
+	source := func(dbname string) string {
+		settings := app.SettingsFor(dbname)
+		name := settings.Content.Name(dbname)
+		if settings.Format == psql.Script {
+			if app.Args.Join {
+				return name + ".chunk"
+			}
+			return name + ".sql"
 		}
+		return name + ".backup"
 	}
 	//
-	// glob returns matches for the given extension in the backups directory.
-	glob := func(extension string, re *regexp.Regexp) []string {
+	// glob returns the sources in the backups directory matching re with the content and format
+	// of each database; masked copies are only restored when named.
+	glob := func(re *regexp.Regexp) []string {
 		var rv []string
-		globs, err := filepath.Glob(filepath.Join(app.Paths.Backups, "*"+extension))
-		app.Error(err)
-		for _, glob := range globs {
-			if re == nil || re.MatchString(filepath.Base(glob)) {
-				rv = append(rv, glob)
+		for _, extension := range []string{".backup", ".sql", ".chunk"} {
+			globs, err := filepath.Glob(filepath.Join(app.Paths.Backups, "*"+extension))
+			app.Error(err)
+			for _, glob := range globs {
+				dbname, _ := psql.ParseName(strings.TrimSuffix(filepath.Base(glob), extension))
+				if source(dbname) != filepath.Base(glob) || strings.HasSuffix(dbname, psql.MaskedSuffix) {
+					continue
+				} else if re == nil || re.MatchString(filepath.Base(glob)) {
+					rv = append(rv, glob)
+				}
 			}
 		}
+		sort.Strings(rv)
 		return rv
 	}
 	//
+	// Targets maps backup names to the database names they are restored into.
+	targets := map[string]string{}
 	if len(app.Args.Remaining) > 0 {
-		// Explicitly listed databases...
-		for _, path := range app.Args.Remaining {
-			paths = append(paths, filepath.Join(app.Paths.Backups, path+ext))
+		// Explicitly listed databases; src:dst restores src into dst.
+		for _, arg := range app.Args.Remaining {
+			src, dst := arg, ""
+			if k := strings.Index(arg, ":"); k >= 0 {
+				src, dst = arg[:k], arg[k+1:]
+			}
+			paths = append(paths, filepath.Join(app.Paths.Backups, source(src)))
+			if dst != "" {
+				targets[src] = Rename(dst, src)
+			}
 		}
 		// Plus those matching the -regexp flag but only if the regexp was specified.
 		if app.Conf.Regexp != nil {
-			paths = append(paths, glob(ext, app.Conf.Regexp)...)
+			paths = append(paths, glob(app.Conf.Regexp)...)
 		}
 	} else {
-		paths = append(paths, glob(ext, app.Conf.Regexp)...)
+		paths = append(paths, glob(app.Conf.Regexp)...)
 	}
 	if len(paths) == 0 {
 		return
 	}
-	dbsCh = make(chan string, len(paths))
+	var dbs, plan, replacing []string
+	restoredInto := map[string]string{}
 	for _, path := range paths {
-		dbsCh <- filepath.Base(strings.TrimSuffix(path, filepath.Ext(path)))
+		dbname, _ := psql.ParseName(filepath.Base(strings.TrimSuffix(path, filepath.Ext(path))))
+		if _, ok := restoredInto[dbname]; ok {
+			continue
+		}
+		target, ok := targets[dbname]
+		if !ok {
+			target = Rename(app.Conf.Rename, dbname)
+			targets[dbname] = target
+		}
+		if app.Conf.IsProtected(target) {
+			app.Warningf("Skipping %v; %v is protected", dbname, target)
+			app.Report.Add(Result{Name: dbname, Status: StatusSkipped, Error: target + " is protected"})
+			continue
+		}
+		for src, dst := range restoredInto {
+			if dst == target {
+				app.Error(fmt.Errorf("%v and %v would both be restored into %v", src, dbname, target))
+			}
+		}
+		restoredInto[dbname] = target
+		dbs = append(dbs, dbname)
+		// A data-only restore goes into the existing database.
+		if app.SettingsFor(dbname).Content != psql.DataOnly {
+			replacing = append(replacing, target)
+		}
+		if target != dbname {
+			plan = append(plan, dbname+" as "+target)
+		} else {
+			plan = append(plan, dbname)
+		}
+	}
+	app.Plan(plan)
+	// A selective restore does not drop anything.
+	if app.Conf.Filter.IsZero() && !app.Confirm(replacing) {
+		os.Exit(255)
 	}
-	close(dbsCh)
-	//
 	//
-	var wg sync.WaitGroup
-	for k := 0; k < app.Ops; k++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			var err error
-			for {
-				select {
-				case dbname, ok := <-dbsCh:
-					if !ok {
-						return
-					}
-					path := filepath.Join(app.Paths.Backups, dbname+ext)
-					app.Infof("Restoring %v from %v", dbname, path)
-					//
-					db := psql.DB{
-						DBName: dbname,
-						PSQL:   app.PSQL,
-					}
-					//
-					if strings.HasSuffix(path, ".chunk") {
-						db.Join(path)
-					}
-					//
-					if err = db.Restore(app.Ctx, app.Conf.Format); err != nil {
-						app.Warningf("Backing up %v failed: %v", dbname, err)
-						continue
-					}
-					//
-					app.Infof("Finished %v", dbname)
-
-				case <-app.Ctx.Done():
-					return
-				}
+	app.Work(dbs, func(ctx context.Context, dbname string) error {
+		path := filepath.Join(app.Paths.Backups, source(dbname))
+		settings := app.SettingsFor(dbname)
+		target := targets[dbname]
+		if target != dbname {
+			app.Infof("Restoring %v into %v from %v", dbname, target, path)
+		} else {
+			app.Infof("Restoring %v from %v", dbname, path)
+		}
+		//
+		db := psql.DB{
+			DBName: dbname,
+			Target: target,
+			PSQL:   app.PSQLFor(dbname),
+			Check: func(ctx context.Context, restored string) error {
+				return app.PostRestore(ctx, dbname, restored)
+			},
+		}
+		//
+		if err := app.CheckServer(ctx, dbname); err != nil {
+			app.Warningf("Restoring %v refused: %v", dbname, err)
+			return err
+		} else if len(db.Masks) > 0 && settings.Format != psql.Script {
+			err = fmt.Errorf("only SQL script backups are masked")
+			app.Warningf("Restoring %v refused: %v", dbname, err)
+			return err
+		} else if app.Conf.ListFile != "" && settings.Format != psql.Directory {
+			err = fmt.Errorf("-use-list only applies to directory backups")
+			app.Warningf("Restoring %v refused: %v", dbname, err)
+			return err
+		} else if app.Conf.Mask && len(db.Masks) == 0 {
+			app.Report.Note(dbname, "not masked; no masks apply to it")
+		}
+		//
+		if strings.HasSuffix(path, ".chunk") {
+			if err := db.Join(path); err != nil {
+				app.Warningf("Join %v failed: %v", dbname, err)
+				return err
 			}
-		}()
-	}
-	wg.Wait()
+		}
+		//
+		if app.Conf.PreBackup {
+			saved, err := app.PreRestoreBackup(ctx, target)
+			if err != nil {
+				app.Warningf("Safety backup of %v failed: %v", target, err)
+				return err
+			} else if saved != "" {
+				app.Infof("\tSafety backup of %v written to %v", target, saved)
+				app.Report.Note(dbname, "safety backup of %v written to %v", target, saved)
+			}
+		}
+		//
+		if app.Conf.Safe && settings.Content != psql.DataOnly {
+			retired, err := db.SafeRestore(ctx, settings.Format)
+			if err != nil {
+				app.Warningf("Restoring %v failed: %v", dbname, err)
+				return err
+			} else if retired != "" {
+				app.Infof("\tThe previous %v is kept as %v until it is dropped", target, retired)
+				app.Report.Note(dbname, "previous %v kept as %v", target, retired)
+			}
+		} else if err := db.Restore(ctx, settings.Format); err != nil {
+			app.Warningf("Restoring %v failed: %v", dbname, err)
+			if ctx.Err() != nil {
+				app.Warningf("\t%v may be partially restored", target)
+			}
+			return err
+		}
+		if app.Conf.ListFile != "" {
+			app.Report.Note(dbname, "restored the entries in %v", app.Conf.ListFile)
+		}
+		//
+		app.Infof("Finished %v", dbname)
+		return nil
+	})
+	app.Summary()
 }
 
 func (app *App) ExecClear() {
@@ -318,7 +512,13 @@ func (app *App) ExecClear() {
 	app.Error(err)
 	hashes, err := filepath.Glob(filepath.Join(app.Paths.Backups, "*.sha512"))
 	app.Error(err)
-	for _, path := range append(backups, append(chunks, append(scripts, hashes...)...)...) {
+	metas, err := filepath.Glob(filepath.Join(app.Paths.Backups, "*.meta.json"))
+	app.Error(err)
+	for _, path := range append(backups, append(chunks, append(scripts, append(hashes, metas...)...)...)...) {
+		if app.Conf.DryRun {
+			app.Infof("rm -rf %v", path)
+			continue
+		}
 		app.Infof("Removing %v", filepath.Base(path))
 		if err = os.RemoveAll(path); err != nil {
 			app.Warningf("%v", err)
@@ -342,6 +542,96 @@ func (app *App) ExecVersion() {
 	}
 }
 
+// Plan prints the databases and settings that will be used by a -dry-run; it does nothing
+// otherwise.
+func (app *App) Plan(dbs []string) {
+	if !app.Conf.DryRun {
+		return
+	}
+	app.Infof("Dry run; nothing will be executed or changed.")
+	app.Infof("\tBackups directory: %v", app.Paths.Backups)
+	app.Infof("\tFormat: %v", app.Conf.Format)
+	if app.Conf.Content != psql.Full {
+		app.Infof("\tContent: %v only", app.Conf.Content)
+	}
+	if app.Args.Backup && app.Conf.Format == psql.Script {
+		if app.Conf.RowsPerInsert > 1 {
+			app.Infof("\tData style: %v with %v rows per insert", app.Conf.DataStyle, app.Conf.RowsPerInsert)
+		} else {
+			app.Infof("\tData style: %v", app.Conf.DataStyle)
+		}
+	}
+	if app.Args.Backup && app.Conf.Format == psql.Script && app.Conf.SplitSize > 0 {
+		app.Infof("\tSplit size: %v", humanize.IBytes(uint64(app.Conf.SplitSize)))
+	}
+	if app.Args.Restore && app.Conf.PreBackup {
+		app.Infof("\tSafety backups are written to %v.", app.Paths.PreRestore)
+	}
+	if filter := app.Conf.Filter; app.Args.Restore && !filter.IsZero() {
+		app.Infof("\tSelective restore into existing databases.")
+		if len(filter.Schemas) > 0 {
+			app.Infof("\tSchemas: %v", strings.Join(filter.Schemas, ", "))
+		}
+		if len(filter.Tables) > 0 {
+			app.Infof("\tTables: %v", strings.Join(filter.Tables, ", "))
+		}
+		if len(filter.ExcludeTables) > 0 {
+			app.Infof("\tExcluded tables: %v", strings.Join(filter.ExcludeTables, ", "))
+		}
+	}
+	if app.Args.Restore && app.Conf.Content == psql.DataOnly {
+		app.Infof("\tData-only restore into existing databases.")
+	}
+	if app.Args.Restore && app.Conf.Safe {
+		app.Infof("\tRestoring into scratch databases before replacing the originals.")
+	}
+	if app.Args.Restore && app.Conf.Format == psql.Script && app.Args.Join {
+		app.Infof("\tJoining split SQL scripts before restore.")
+	}
+	if app.Conf.Mask {
+		if app.Args.Backup {
+			app.Infof("\tWriting masked copies of SQL script backups.")
+		} else {
+			app.Infof("\tMasking the data restored from SQL script backups.")
+		}
+		var masks []string
+		for name, rule := range app.Conf.Masks {
+			masks = append(masks, name+" "+rule.Action)
+		}
+		sort.Strings(masks)
+		if len(masks) > 0 {
+			app.Infof("\tMasks: %v", strings.Join(masks, ", "))
+		}
+	}
+	if len(dbs) == 0 {
+		app.Infof("\tDatabases: none")
+		return
+	}
+	app.Infof("\tDatabases (%v): %v", len(dbs), strings.Join(dbs, ", "))
+	for _, db := range dbs {
+		// Restores and clones are planned as "src as dst".
+		if name := strings.SplitN(db, " as ", 2)[0]; len(app.Conf.DatabasesFor(name)) > 0 {
+			app.Infof("\t\t%v: %v", name, app.SettingsFor(name))
+		}
+	}
+}
+
+// Summary prints the report of a backup or restore; nothing is printed for a -dry-run.
+func (app *App) Summary() {
+	if !app.Conf.DryRun {
+		app.Report.Summarize(app.Logger)
+	}
+}
+
+// Rename returns the database name for name according to pattern; every * in pattern is
+// replaced by name.  If pattern is empty name is returned.
+func Rename(pattern, name string) string {
+	if pattern == "" {
+		return name
+	}
+	return strings.ReplaceAll(pattern, "*", name)
+}
+
 // Summarize prints a log line describing what the application is doing with
 // concurrency information.
 func (app *App) Summarize() {
@@ -350,10 +640,46 @@ func (app *App) Summarize() {
 		if app.Conf.Format == psql.Directory {
 			app.Infof("\tEach backup uses %v jobs.", app.Jobs)
 		}
-	} else if app.Args.Restore {
+		if app.Conf.Verify {
+			app.Infof("\tRows in every table are counted for -verify.")
+		}
+	} else if app.Args.Clone {
+		app.Infof("Cloning with %v concurrent clones across %v CPUs", app.Ops, app.CPUs)
+	} else if app.Args.Restore || app.Args.Drill {
 		app.Infof("Restoring with %v concurrent restores across %v CPUs", app.Ops, app.CPUs)
 		if app.Conf.Format == psql.Directory {
 			app.Infof("\tEach restore uses %v jobs.", app.Jobs)
 		}
+		if app.Conf.ListFile != "" {
+			app.Infof("\tRestoring the entries in %v from directory backups.", app.Conf.ListFile)
+		}
+		if app.Conf.Vacuum {
+			app.Infof("\tEach database is vacuumed and analyzed after it is restored.")
+		} else if app.Conf.Analyze {
+			app.Infof("\tEach database is analyzed after it is restored.")
+		}
+		if app.Conf.Verify {
+			app.Infof("\tRestored counts are verified to within %v%%.", app.Conf.Tolerance)
+		}
+		if app.Conf.NoOwner {
+			app.Infof("\tObjects are owned by the restoring user.")
+		}
+		if app.Conf.NoPrivileges {
+			app.Infof("\tGrants and revokes are skipped.")
+		}
+		if app.PSQL.MapsRoles() {
+			var mappings []string
+			for from, to := range app.Conf.Roles {
+				mappings = append(mappings, from+" -> "+to)
+			}
+			sort.Strings(mappings)
+			app.Infof("\tRoles are mapped: %v", strings.Join(mappings, ", "))
+		}
+	}
+	if app.Conf.Timeout > 0 {
+		app.Infof("\tEach database is limited to %v.", app.Conf.Timeout)
+	}
+	if !app.Conf.Deadline.IsZero() {
+		app.Infof("\tNo databases are started after %v.", app.Conf.Deadline.Format("2006-01-02 15:04:05"))
 	}
 }
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"pgbackup/psql"
+)
+
+// Tools are the binaries that are resolved from the bin directories.
+var Tools = []string{"psql", "pg_dump", "pg_restore"}
+
+// ResolveBinaries sets the binaries p runs to those in the bin directory configured for the major
+// version of its server; binaries set explicitly in the configuration take precedence.  If the
+// version cannot be read or has no bin directory the binaries on PATH are used.  server names the
+// server in messages.
+func (app *App) ResolveBinaries(ctx context.Context, p *psql.PSQL, server string) {
+	p.Binaries = map[string]string{}
+	for tool, path := range app.Conf.Binaries {
+		p.Binaries[tool] = path
+	}
+	if len(app.Conf.BinDirs) == 0 {
+		return
+	}
+	// The version is read even in a dry run so the plan shows the binaries that would run.
+	probe := psql.DB{
+		PSQL: *p,
+	}
+	probe.DryRun = false
+	version, err := probe.ServerVersion(ctx)
+	if err != nil {
+		app.Warningf("Unable to read the version of the %v server; using binaries on PATH: %v", server, err)
+		return
+	}
+	major := psql.MajorVersion(version)
+	dir, ok := app.Conf.BinDirs[major]
+	if !ok {
+		app.Warningf("No bin directory is configured for PostgreSQL %v on the %v server; using binaries on PATH", major, server)
+		return
+	}
+	for _, tool := range Tools {
+		if _, ok := p.Binaries[tool]; ok {
+			continue
+		}
+		p.Binaries[tool] = filepath.Join(dir, tool)
+		if _, err := os.Stat(p.Binaries[tool]); err != nil {
+			app.Warningf("%v", err)
+		}
+	}
+	if app.Args.Verbose || app.Conf.DryRun {
+		app.Infof("Using binaries in %v for PostgreSQL %v on the %v server", dir, major, server)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"pgbackup/psql"
+)
+
+// ExecClone copies each database named as src[:dst] on the command line from the -from server
+// into dst on the -to server without writing to disk.  dst defaults to src renamed by -rename.
+func (app *App) ExecClone() {
+	app.Infof("Start clone...")
+	defer app.Infof("\tdone")
+	//
+	app.Summarize()
+	//
+	if len(app.Args.Remaining) == 0 {
+		app.Errorf("-clone expects one or more databases as src[:dst]")
+		os.Exit(255)
+	}
+	src := app.PSQL
+	src.Conn = app.Conf.CloneFrom
+	app.ResolveBinaries(app.Ctx, &src, "source")
+	//
+	var dbs, plan, replacing []string
+	targets := map[string]string{}
+	clonedInto := map[string]string{}
+	for _, arg := range app.Args.Remaining {
+		dbname, target := arg, ""
+		if k := strings.Index(arg, ":"); k >= 0 {
+			dbname, target = arg[:k], arg[k+1:]
+		}
+		if target == "" {
+			target = Rename(app.Conf.Rename, dbname)
+		}
+		if _, ok := targets[dbname]; ok {
+			continue
+		} else if target == dbname && app.Conf.CloneFrom == app.Conf.CloneTo {
+			app.Error(fmt.Errorf("%v would be cloned onto itself; use -to or src:dst", dbname))
+		} else if app.Conf.IsProtected(target) {
+			app.Warningf("Skipping %v; %v is protected", dbname, target)
+			app.Report.Add(Result{Name: dbname, Status: StatusSkipped, Error: target + " is protected"})
+			continue
+		}
+		for other, dst := range clonedInto {
+			if dst == target {
+				app.Error(fmt.Errorf("%v and %v would both be cloned into %v", other, dbname, target))
+			}
+		}
+		targets[dbname], clonedInto[dbname] = target, target
+		dbs = append(dbs, dbname)
+		replacing = append(replacing, target)
+		if target != dbname {
+			plan = append(plan, dbname+" as "+target)
+		} else {
+			plan = append(plan, dbname)
+		}
+	}
+	app.Plan(plan)
+	if !app.Confirm(replacing) {
+		os.Exit(255)
+	}
+	//
+	app.Work(dbs, func(ctx context.Context, dbname string) error {
+		target := targets[dbname]
+		app.Infof("Cloning %v into %v", dbname, target)
+		db := psql.DB{
+			DBName: dbname,
+			Target: target,
+			PSQL:   app.PSQLFor(dbname),
+			Check: func(ctx context.Context, cloned string) error {
+				return app.PostRestore(ctx, dbname, cloned)
+			},
+		}
+		from := src
+		from.Args = app.SettingsFor(dbname).Args
+		if err := db.Clone(ctx, from); err != nil {
+			app.Warningf("Cloning %v failed: %v", dbname, err)
+			if ctx.Err() != nil {
+				app.Warningf("\t%v may be partially cloned", target)
+			}
+			return err
+		}
+		app.Infof("Finished %v", dbname)
+		return nil
+	})
+	app.Summary()
+}
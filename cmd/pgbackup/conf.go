@@ -1,8 +1,12 @@
 package main
 
 import (
+	"path"
 	"pgbackup/psql"
+	"pgbackup/script"
 	"regexp"
+	"sort"
+	"time"
 )
 
 // Conf specifies configuration for the command.
@@ -16,4 +20,154 @@ type Conf struct {
 	// SplitSize specifies the size in bytes to split SQL parts; if 0 or less
 	// then no splitting occurs.
 	SplitSize int
+	//
+	// Content is what backups hold; schema-only and data-only backups are named apart from full
+	// backups.
+	Content psql.Content
+	//
+	// DataStyle is how table data is written to SQL script backups and RowsPerInsert is the
+	// number of rows in each INSERT statement.
+	DataStyle     psql.DataStyle
+	RowsPerInsert int
+	//
+	// CloneFrom and CloneTo are the connection strings for the servers -clone copies from and
+	// to; if empty the libpq defaults are used.
+	CloneFrom string
+	CloneTo   string
+	//
+	// Rename is the pattern for naming databases during restore; every * is replaced by
+	// the name of the backup.  If empty databases are restored under their own names.
+	Rename string
+	//
+	// Safe restores into a scratch database and only replaces the original once the
+	// restore succeeds; the original is kept under a dated name.
+	Safe bool
+	//
+	// PreBackup takes a safety backup of each existing database before a restore replaces it.
+	PreBackup bool
+	//
+	// PreBackupKeep is the number of safety backups kept for each database; if 0 or less
+	// they are never removed.
+	PreBackupKeep int
+	//
+	// Protected lists databases that are never dropped by a restore; entries may be shell
+	// patterns.
+	Protected []string
+	//
+	// Yes skips the confirmation before a restore replaces existing databases.
+	Yes bool
+	//
+	// Filter selects the objects restored; a selective restore goes into an existing database
+	// without dropping it.
+	Filter psql.Filter
+	//
+	// ListFile is a list file edited from the output of pg_restore -l that selects the archive
+	// entries restored from directory backups.
+	ListFile string
+	//
+	// NoOwner restores objects owned by the restoring user instead of their original owners.
+	NoOwner bool
+	//
+	// NoPrivileges restores objects without their grants and revokes.
+	NoPrivileges bool
+	//
+	// Roles maps the owners and grantees in backups to the roles used in their place on restore.
+	Roles map[string]string
+	//
+	// Analyze runs ANALYZE in each database after it is restored.
+	Analyze bool
+	//
+	// Vacuum runs VACUUM ANALYZE in each database after it is restored.
+	Vacuum bool
+	//
+	// Verify records the rows in every table when backing up and compares the objects and rows
+	// of each restored database with those recorded.
+	Verify bool
+	//
+	// Tolerance is the percentage by which restored counts may differ from those recorded.
+	Tolerance float64
+	//
+	// Assertions are queries run by -drill in each restored database; each must return a
+	// single true value.  They are keyed by patterns matched against database names.
+	Assertions map[string][]string
+	//
+	// IgnoreCompat restores backups into older servers or servers missing extensions the backup
+	// uses with only a warning.
+	IgnoreCompat bool
+	//
+	// BinDirs maps PostgreSQL major versions such as 16 to the directories holding the psql,
+	// pg_dump, and pg_restore that match them.
+	BinDirs map[string]string
+	//
+	// Binaries maps psql, pg_dump, and pg_restore to the paths of the binaries always run for
+	// them.
+	Binaries map[string]string
+	//
+	// Args maps psql, pg_dump, and pg_restore to extra arguments passed to them for every
+	// database.
+	Args map[string][]string
+	//
+	// Databases holds settings for the databases matching each key.
+	Databases map[string]DatabaseConf
+	//
+	// Mask masks the data of SQL script backups with the rules in Masks: -backup writes a masked
+	// copy beside each backup and -restore masks the data it restores.
+	Mask  bool
+	Masks script.Masks
+	//
+	// Terminate blocks new connections and terminates existing sessions before a database
+	// is dropped by a restore.
+	Terminate bool
+	//
+	// Timeout limits the time spent on a single database; if 0 or less there is no limit.
+	Timeout time.Duration
+	//
+	// Deadline is the time after which no further databases are started; if zero there
+	// is no deadline.
+	Deadline time.Time
+	//
+	// Grace is how long running work is given to clean up after a signal before the
+	// application exits.
+	Grace time.Duration
+	//
+	// WaitLock is how long to wait for another process to release the lock on the
+	// backups directory.
+	WaitLock time.Duration
+	//
+	// DryRun prints commands and file removals without running them.
+	DryRun bool
+	//
+	// Retry specifies the retry policy for failed backups and restores.
+	Retry psql.Retry
+}
+
+// IsProtected returns true if dbname matches an entry in Protected.
+func (conf Conf) IsProtected(dbname string) bool {
+	for _, pattern := range conf.Protected {
+		if ok, _ := path.Match(pattern, dbname); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// DatabasesFor returns the entries in Databases that apply to dbname in the order they are
+// applied: the patterns matching dbname in sorted order followed by the entry naming dbname
+// exactly.
+func (conf Conf) DatabasesFor(dbname string) []DatabaseConf {
+	var rv []DatabaseConf
+	var patterns []string
+	for pattern := range conf.Databases {
+		if ok, _ := path.Match(pattern, dbname); ok && pattern != dbname {
+			patterns = append(patterns, pattern)
+		}
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		rv = append(rv, conf.Databases[pattern])
+	}
+	if db, ok := conf.Databases[dbname]; ok {
+		rv = append(rv, db)
+	}
+	return rv
 }
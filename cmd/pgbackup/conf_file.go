@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"pgbackup/psql"
+	"pgbackup/script"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// majorVersion matches a PostgreSQL major version such as 16 or 9.6.
+var majorVersion = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+
+// ConfFile is the optional JSON configuration file.
+type ConfFile struct {
+	// Protected lists databases that are never dropped by -restore; entries may be
+	// shell patterns such as prod_*.
+	Protected []string `json:"protected"`
+	//
+	// Roles maps the owners and grantees in backups to the roles used in their place on
+	// -restore, such as {"prod_app": "staging_app"}.
+	Roles map[string]string `json:"roles"`
+	//
+	// Assertions are queries run by -drill in each restored database keyed by patterns matched
+	// against database names, such as {"*": ["select count(*) > 0 from public.users"]}; each
+	// query must return a single true value.
+	Assertions map[string][]string `json:"assertions"`
+	//
+	// BinDirs maps PostgreSQL major versions to the directories holding the matching psql,
+	// pg_dump, and pg_restore, such as {"16": "/usr/lib/postgresql/16/bin"}.  The binaries for
+	// the version of the server are used.
+	BinDirs map[string]string `json:"bin_dirs"`
+	//
+	// Binaries maps psql, pg_dump, and pg_restore to the paths of the binaries always run for
+	// them, such as {"pg_dump": "/opt/pg/bin/pg_dump"}; they take precedence over BinDirs.
+	Binaries map[string]string `json:"binaries"`
+	//
+	// Args maps psql, pg_dump, and pg_restore to extra arguments passed to them for every
+	// database, such as {"pg_dump": ["--no-comments"]}.
+	Args map[string][]string `json:"args"`
+	//
+	// Databases holds settings for the databases matching each key; keys may be shell patterns
+	// such as prod_*.
+	Databases map[string]DatabaseConf `json:"databases"`
+	//
+	// Masks are the rules -mask applies to the data of SQL script backups keyed by
+	// schema.table.column, or schema.table for truncate, such as
+	// {"users.email": {"action": "email"}, "audit_log": {"action": "truncate"}}; names without a
+	// schema are in public.
+	Masks map[string]script.MaskRule `json:"masks"`
+}
+
+// DatabaseConf holds the settings for some databases in the configuration file; settings that
+// are left empty keep the values from the command line.
+type DatabaseConf struct {
+	// Format is the backup format, dir or sql, as for -format.
+	Format string `json:"format"`
+	// Content is what backups hold: full, schema or data as for -schema-only and -data-only.
+	Content string `json:"content"`
+	// Split is the size of the parts of SQL script backups, such as 64MiB, as for -split; 0
+	// turns splitting off.
+	Split string `json:"split"`
+	// Jobs is the number of jobs of pg_dump and pg_restore for directory backups.
+	Jobs int `json:"jobs"`
+	// Compression is passed to pg_dump -Z for directory backups, such as 0 or 9 or zstd:3 with
+	// newer servers; SQL script backups are not compressed.
+	Compression string `json:"compression"`
+	// Timeout limits the time spent on the database, such as 2h, as for -timeout; 0 removes the
+	// limit.
+	Timeout string `json:"timeout"`
+	// Args maps psql, pg_dump, and pg_restore to extra arguments passed to them after those in
+	// ConfFile.Args.
+	Args map[string][]string `json:"args"`
+	// Masks are rules for -mask added to or replacing those in ConfFile.Masks.
+	Masks map[string]script.MaskRule `json:"masks"`
+}
+
+// Apply applies the settings in db to settings.
+func (db DatabaseConf) Apply(settings *Settings) error {
+	switch db.Format {
+	case "":
+	case FlagFormatDirectory:
+		settings.Format = psql.Directory
+	case FlagFormatScript:
+		settings.Format = psql.Script
+	default:
+		return fmt.Errorf("format %q: expected one of: %v, %v", db.Format, FlagFormatDirectory, FlagFormatScript)
+	}
+	switch db.Content {
+	case "":
+	case psql.Full.String():
+		settings.Content = psql.Full
+	case psql.SchemaOnly.String():
+		settings.Content = psql.SchemaOnly
+	case psql.DataOnly.String():
+		settings.Content = psql.DataOnly
+	default:
+		return fmt.Errorf("content %q: expected one of: %v, %v, %v", db.Content, psql.Full, psql.SchemaOnly, psql.DataOnly)
+	}
+	if db.Split != "" {
+		parsed, err := humanize.ParseBytes(db.Split)
+		if err != nil {
+			return fmt.Errorf("split %q: %w", db.Split, err)
+		}
+		settings.SplitSize = int(parsed)
+	}
+	if db.Jobs < 0 {
+		return fmt.Errorf("jobs %v: must not be negative", db.Jobs)
+	} else if db.Jobs > 0 {
+		settings.Jobs = db.Jobs
+	}
+	if db.Compression != "" {
+		settings.Compression = db.Compression
+	}
+	if db.Timeout != "" {
+		timeout, err := time.ParseDuration(db.Timeout)
+		if err != nil {
+			return fmt.Errorf("timeout %q: %w", db.Timeout, err)
+		}
+		settings.Timeout = timeout
+	}
+	for tool, list := range db.Args {
+		settings.Args[tool] = append(settings.Args[tool], list...)
+	}
+	masks, err := script.ParseMasks(db.Masks)
+	if err != nil {
+		return fmt.Errorf("masks %w", err)
+	}
+	for name, rule := range masks {
+		settings.Masks[name] = rule
+	}
+	return nil
+}
+
+// LoadConfFile loads the configuration file at filename.  A missing file is only an error
+// when required is true.
+func LoadConfFile(filename string, required bool) (ConfFile, error) {
+	var rv ConfFile
+	fd, err := os.Open(filename)
+	if os.IsNotExist(err) && !required {
+		return rv, nil
+	} else if err != nil {
+		return rv, err
+	}
+	defer fd.Close()
+	//
+	dec := json.NewDecoder(fd)
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&rv); err != nil {
+		return rv, fmt.Errorf("%v: %w", filename, err)
+	}
+	for _, pattern := range rv.Protected {
+		if _, err = path.Match(pattern, ""); err != nil {
+			return rv, fmt.Errorf("%v: protected %q: %w", filename, pattern, err)
+		}
+	}
+	for pattern := range rv.Assertions {
+		if _, err = path.Match(pattern, ""); err != nil {
+			return rv, fmt.Errorf("%v: assertions %q: %w", filename, pattern, err)
+		}
+	}
+	for major := range rv.BinDirs {
+		if !majorVersion.MatchString(major) {
+			return rv, fmt.Errorf("%v: bin_dirs %q: expected a major version such as 16 or 9.6", filename, major)
+		}
+	}
+	for tool := range rv.Binaries {
+		if !contains(Tools, tool) {
+			return rv, fmt.Errorf("%v: binaries %q: expected one of %v", filename, tool, strings.Join(Tools, ", "))
+		}
+	}
+	if err = checkArgs(rv.Args); err != nil {
+		return rv, fmt.Errorf("%v: args: %w", filename, err)
+	}
+	if _, err = script.ParseMasks(rv.Masks); err != nil {
+		return rv, fmt.Errorf("%v: masks %w", filename, err)
+	}
+	for pattern, db := range rv.Databases {
+		if _, err = path.Match(pattern, ""); err != nil {
+			return rv, fmt.Errorf("%v: databases %q: %w", filename, pattern, err)
+		} else if err = checkArgs(db.Args); err != nil {
+			return rv, fmt.Errorf("%v: databases %q: args: %w", filename, pattern, err)
+		} else if err = db.Apply(&Settings{Args: map[string][]string{}, Masks: script.Masks{}}); err != nil {
+			return rv, fmt.Errorf("%v: databases %q: %w", filename, pattern, err)
+		}
+	}
+	for from, to := range rv.Roles {
+		if from == "" || to == "" {
+			return rv, fmt.Errorf("%v: roles %q: %q: role names must not be empty", filename, from, to)
+		}
+	}
+	return rv, nil
+}
+
+// Apply copies the settings from the file into conf.
+func (f ConfFile) Apply(conf *Conf) {
+	conf.Protected = append([]string(nil), f.Protected...)
+	conf.Assertions = map[string][]string{}
+	for pattern, queries := range f.Assertions {
+		conf.Assertions[pattern] = append([]string(nil), queries...)
+	}
+	conf.BinDirs = map[string]string{}
+	for major, dir := range f.BinDirs {
+		conf.BinDirs[major] = dir
+	}
+	conf.Binaries = map[string]string{}
+	for tool, path := range f.Binaries {
+		conf.Binaries[tool] = path
+	}
+	conf.Roles = map[string]string{}
+	for from, to := range f.Roles {
+		conf.Roles[from] = to
+	}
+	conf.Args = copyArgs(f.Args)
+	// Rules were checked when the file was loaded.
+	conf.Masks, _ = script.ParseMasks(f.Masks)
+	conf.Databases = map[string]DatabaseConf{}
+	for pattern, db := range f.Databases {
+		db.Args = copyArgs(db.Args)
+		conf.Databases[pattern] = db
+	}
+}
+
+// checkArgs returns an error if args maps an unknown tool or holds an argument pgbackup controls.
+func checkArgs(args map[string][]string) error {
+	for tool, list := range args {
+		if !contains(Tools, tool) {
+			return fmt.Errorf("%q: expected one of %v", tool, strings.Join(Tools, ", "))
+		} else if err := psql.CheckArgs(tool, list); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyArgs returns a copy of the extra arguments args.
+func copyArgs(args map[string][]string) map[string][]string {
+	rv := map[string][]string{}
+	for tool, list := range args {
+		rv[tool] = append([]string(nil), list...)
+	}
+	return rv
+}
+
+// contains returns true if s is in list.
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
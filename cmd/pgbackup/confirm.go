@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+
+	"pgbackup/psql"
+)
+
+// Confirm lists the databases among targets that a restore will replace and asks for
+// confirmation; it returns false if the restore should not go ahead.
+//
+// Confirmation is skipped with -yes and refused when stdin is not a terminal.
+func (app *App) Confirm(targets []string) bool {
+	db := psql.DB{PSQL: app.PSQL}
+	existing, err := db.Databases(app.Ctx, targets)
+	app.Error(err)
+	if len(existing) == 0 {
+		return true
+	}
+	//
+	width := 0
+	for _, database := range existing {
+		if len(database.Name) > width {
+			width = len(database.Name)
+		}
+	}
+	verb := "dropped and replaced"
+	if app.Conf.Safe {
+		verb = "replaced"
+	}
+	app.Infof("The following %v databases will be %v:", len(existing), verb)
+	for _, database := range existing {
+		activity := "no sessions connected"
+		if !database.LastActivity.IsZero() {
+			activity = "last activity " + database.LastActivity.Format("2006-01-02 15:04:05")
+		}
+		app.Infof("\t%-*v  %10v  %v", width, database.Name, humanize.IBytes(uint64(database.Size)), activity)
+	}
+	//
+	if app.Conf.Yes {
+		return true
+	} else if stat, err := os.Stdin.Stat(); err != nil || stat.Mode()&os.ModeCharDevice == 0 {
+		app.Errorf("Refusing to replace databases without confirmation; use -yes when not running from a terminal.")
+		return false
+	}
+	fmt.Print(`Type "yes" to continue: `)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if strings.TrimSpace(answer) != "yes" {
+		app.Errorf("Restore cancelled.")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"pgbackup/psql"
+	"pgbackup/script"
+)
+
+// ExecDiffSchema compares the schema in the backup of each database named on the command line
+// with the schema of the live database and prints the differences as a unified diff grouped by
+// object type.  It exits with 1 if any schema differs and with 2 if a comparison failed.
+func (app *App) ExecDiffSchema() {
+	var differs, failed bool
+	//
+	if len(app.Args.Remaining) == 0 {
+		app.Errorf("-diff-schema expects the names of one or more databases")
+		os.Exit(255)
+	}
+	for _, dbname := range app.Args.Remaining {
+		db := psql.DB{
+			DBName: dbname,
+			PSQL:   app.PSQLFor(dbname),
+		}
+		backup, err := db.BackupSchema(app.Ctx, app.BackupFormat(dbname))
+		if err != nil {
+			app.Errorf("Unable to read the schema in the backup of %v: %v", dbname, err)
+			failed = true
+			continue
+		}
+		live, err := db.LiveSchema(app.Ctx, dbname)
+		if err != nil {
+			app.Errorf("Unable to dump the schema of %v: %v", dbname, err)
+			failed = true
+			continue
+		}
+		lines := DiffSchema(backup, live)
+		if app.Conf.DryRun {
+			continue
+		} else if len(lines) == 0 {
+			app.Infof("%v: the schema matches the backup", dbname)
+			continue
+		}
+		differs = true
+		fmt.Printf("--- %v (backup)\n+++ %v (live)\n", dbname, dbname)
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+	}
+	//
+	if failed {
+		os.Exit(2)
+	} else if differs {
+		os.Exit(1)
+	}
+}
+
+// DiffSchema returns the lines of a unified diff from the objects in backup to the objects in
+// live.  Objects are grouped by type; each group starts with a line naming the type and each
+// object that differs starts with a line naming the object and how it differs.
+func DiffSchema(backup, live []script.Object) []string {
+	var rv []string
+	// Each pair holds the object in the backup and in the live database; either may be nil.
+	var pairs []*[2]*script.Object
+	byKey := map[string]*[2]*script.Object{}
+	add := func(object *script.Object, side int) {
+		pair, ok := byKey[object.Key()]
+		if !ok {
+			pair = &[2]*script.Object{}
+			byKey[object.Key()] = pair
+			pairs = append(pairs, pair)
+		}
+		pair[side] = object
+	}
+	for k := range backup {
+		add(&backup[k], 0)
+	}
+	for k := range live {
+		add(&live[k], 1)
+	}
+	// either returns the object of the pair that is present.
+	either := func(pair *[2]*script.Object) *script.Object {
+		if pair[0] != nil {
+			return pair[0]
+		}
+		return pair[1]
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		a, b := either(pairs[i]), either(pairs[j])
+		if a.Header.Type != b.Header.Type {
+			return a.Header.Type < b.Header.Type
+		}
+		return a.Name() < b.Name()
+	})
+	//
+	var typ string
+	for _, pair := range pairs {
+		var old, new, how string
+		switch {
+		case pair[1] == nil:
+			old, how = pair[0].Text, "only in the backup"
+		case pair[0] == nil:
+			new, how = pair[1].Text, "only in the live database"
+		case pair[0].Text != pair[1].Text:
+			old, new, how = pair[0].Text, pair[1].Text, "changed"
+		default:
+			continue
+		}
+		object := either(pair)
+		if object.Header.Type != typ {
+			typ = object.Header.Type
+			rv = append(rv, fmt.Sprintf("## %v", typ))
+		}
+		rv = append(rv, fmt.Sprintf("# %v: %v", object.Name(), how))
+		rv = append(rv, script.Unified(script.Diff(script.Lines(old), script.Lines(new)), 3)...)
+	}
+	return rv
+}
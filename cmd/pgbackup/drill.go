@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"pgbackup/psql"
+)
+
+// DrillPrefix is prepended to the name of a database to name the scratch database a drill
+// restores it into.
+const DrillPrefix = "pgbackup_drill_"
+
+// Drill is the outcome of a restore drill; each is appended to the history file as a line of
+// JSON.
+type Drill struct {
+	Database string `json:"database"`
+	// Backup is when the backup was taken if it is known.
+	Backup time.Time `json:"backup,omitempty"`
+	Start  time.Time `json:"start"`
+	// RestoreSeconds is the time spent restoring and Seconds the time for the whole drill.
+	RestoreSeconds float64 `json:"restore_seconds"`
+	Seconds        float64 `json:"seconds"`
+	Passed         bool    `json:"passed"`
+	Error          string  `json:"error,omitempty"`
+}
+
+// ExecDrill restores the backup of each database into a scratch database, checks it against the
+// counts recorded at backup time and the configured assertions, and drops it again.  The outcome
+// of each drill is appended to the history file.
+func (app *App) ExecDrill() {
+	app.Infof("Start restore drills...")
+	defer app.Infof("\tdone")
+	//
+	app.Summarize()
+	//
+	dbs := app.Backups()
+	if app.Args.Sample > 0 && app.Args.Sample < len(dbs) {
+		rand.Shuffle(len(dbs), func(i, j int) {
+			dbs[i], dbs[j] = dbs[j], dbs[i]
+		})
+		dbs = dbs[:app.Args.Sample]
+		sort.Strings(dbs)
+	}
+	// Shortened scratch names end with a hash of the whole name, but two drills must never
+	// share a scratch database.
+	drilledIn := map[string]string{}
+	for _, dbname := range dbs {
+		target := DrillTarget(dbname)
+		if other, ok := drilledIn[target]; ok {
+			app.Error(fmt.Errorf("%v and %v would both be drilled in %v", other, dbname, target))
+		}
+		drilledIn[target] = dbname
+	}
+	app.Plan(dbs)
+	app.Work(dbs, func(ctx context.Context, dbname string) error {
+		drill := Drill{
+			Database: dbname,
+			Start:    time.Now(),
+		}
+		err := app.drill(ctx, dbname, &drill)
+		drill.Seconds = time.Since(drill.Start).Seconds()
+		if err != nil {
+			drill.Error = err.Error()
+			app.Warningf("Drill of %v failed: %v", dbname, err)
+		} else {
+			drill.Passed = true
+			app.Infof("Drill of %v passed in %v", dbname, time.Since(drill.Start).Round(time.Second))
+		}
+		if !app.Conf.DryRun {
+			if err := app.RecordDrill(drill); err != nil {
+				app.Warningf("Recording the drill of %v failed: %v", dbname, err)
+			}
+		}
+		return err
+	})
+	app.Summary()
+}
+
+// DrillTarget returns the name of the scratch database a drill restores dbname into.
+func DrillTarget(dbname string) string {
+	return psql.Suffixed(DrillPrefix+dbname, "")
+}
+
+// drill runs a single drill of dbname and fills in drill as it goes.
+func (app *App) drill(ctx context.Context, dbname string, drill *Drill) error {
+	target := DrillTarget(dbname)
+	app.Infof("Drilling %v in %v", dbname, target)
+	//
+	start := time.Now()
+	db := psql.DB{
+		DBName: dbname,
+		Target: target,
+		PSQL:   app.PSQLFor(dbname),
+		Check: func(ctx context.Context, restored string) error {
+			drill.RestoreSeconds = time.Since(start).Seconds()
+			if err := app.Verify(ctx, dbname, restored, true); err != nil {
+				return err
+			}
+			return app.Assert(ctx, dbname, restored)
+		},
+	}
+	if meta, err := db.ReadMeta(); err == nil {
+		drill.Backup = meta.Created
+	}
+	if db.Content == psql.DataOnly {
+		return errors.New("data-only backups need an existing schema and cannot be drilled")
+	} else if err := app.CheckServer(ctx, dbname); err != nil {
+		return err
+	}
+	defer db.Cleanup(target)
+	return db.Restore(ctx, app.SettingsFor(dbname).Format)
+}
+
+// Assert runs the assertions configured for dbname in target; each must return a single true
+// value.
+func (app *App) Assert(ctx context.Context, dbname string, target string) error {
+	var patterns []string
+	for pattern := range app.Conf.Assertions {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	//
+	db := psql.DB{
+		DBName: dbname,
+		PSQL:   app.PSQL,
+	}
+	var n int
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, dbname); !ok {
+			continue
+		}
+		for _, sql := range app.Conf.Assertions[pattern] {
+			if err := db.Assert(ctx, target, sql); err != nil {
+				return err
+			}
+			n++
+		}
+	}
+	if n > 0 {
+		app.Report.Note(dbname, "%v assertions passed", n)
+	}
+	return nil
+}
+
+// RecordDrill appends drill to the history file.
+func (app *App) RecordDrill(drill Drill) error {
+	buf, err := json.Marshal(drill)
+	if err != nil {
+		return err
+	}
+	fd, err := os.OpenFile(app.Files.History, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0660)
+	if err != nil {
+		return err
+	}
+	// A single write per line keeps lines from concurrent drills whole.
+	if _, err = fd.Write(append(buf, '\n')); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
+
+// Backups returns the names of the backups in the format configured for each database; if
+// databases are named on the command line only those and any matching -regexp are returned.
+func (app *App) Backups() []string {
+	var rv []string
+	seen := map[string]bool{}
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			rv = append(rv, name)
+		}
+	}
+	for _, name := range app.Args.Remaining {
+		add(name)
+	}
+	if len(app.Args.Remaining) == 0 || app.Conf.Regexp != nil {
+		var names []string
+		for ext, format := range map[string]psql.Format{".backup": psql.Directory, ".sql": psql.Script} {
+			globs, err := filepath.Glob(filepath.Join(app.Paths.Backups, "*"+ext))
+			app.Error(err)
+			for _, glob := range globs {
+				name := strings.TrimSuffix(filepath.Base(glob), ext)
+				dbname, _ := psql.ParseName(name)
+				if settings := app.SettingsFor(dbname); settings.Format != format || settings.Content.Name(dbname) != name {
+					continue
+				} else if strings.HasSuffix(dbname, psql.MaskedSuffix) {
+					continue
+				} else if app.Conf.Regexp == nil || app.Conf.Regexp.MatchString(filepath.Base(glob)) {
+					names = append(names, dbname)
+				}
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			add(name)
+		}
+	}
+	return rv
+}
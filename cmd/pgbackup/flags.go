@@ -1,29 +1,136 @@
 package main
 
+import (
+	"strings"
+	"time"
+)
+
 // Flags are the command line options.
 type Flags struct {
+	// Analyze databases after restore.
+	Analyze bool
 	// Backup all databases.
 	Backup bool
 	// Clear all backups from backup directory.
 	Clear bool
+	// Clone databases between servers.
+	Clone bool
+	// Path to the configuration file.
+	Config string
+	// Tables never restored.
+	ExcludeTables Strings
+	// Back up or restore only the data.
+	DataOnly bool
+	// How table data is written to SQL script backups.
+	DataStyle string
+	// Deadline after which no further databases are started; a duration or a clock time.
+	Deadline string
+	// Compare the schema in backups with live databases.
+	DiffSchema bool
+	// Restore drills.
+	Drill bool
+	// Print the plan without running anything.
+	DryRun bool
 	// Format defines the backup format; one of "dir" or "sql".
 	Format string
+	// Connection string for the server -clone copies from.
+	From string
+	// Time allowed for cleanup after a signal.
+	Grace time.Duration
 	// Print help message and exit.
 	Help bool
+	// Inspect the contents of backups.
+	Inspect bool
+	// JSON prints -inspect output as JSON.
+	JSON bool
+	// Restore into incompatible servers.
+	IgnoreCompat bool
 	// Join tells -restore to restore from backup.chunk sources.
 	Join bool
 	// List databases to backup.
 	List bool
+	// Take a safety backup before a restore replaces a database.
+	PreBackup bool
+	// Number of safety backups kept for each database.
+	PreBackupKeep int
+	// Role mappings for restore as old=new.
+	MapRoles Strings
+	// Mask the data of SQL script backups with the rules in the configuration file.
+	Mask bool
+	// Restore without original owners.
+	NoOwner bool
+	// Restore without grants and revokes.
+	NoPrivileges bool
 	// Regexp used to match databases for backup or restore.
 	Regexp string
+	// Pattern for naming databases during restore.
+	Rename string
 	// Restore all databases.
 	Restore bool
+	// Number of rows in each INSERT statement of SQL script backups.
+	RowsPerInsert int
+	// Number of times a failed backup or restore is retried.
+	Retries int
+	// Delay before the first retry.
+	RetryDelay time.Duration
+	// Maximum delay between retries.
+	RetryMaxDelay time.Duration
+	// Number of backups drilled at random.
+	Sample int
+	// Restore into a scratch database and swap it into place.
+	Safe bool
+	// Schemas to restore.
+	Schemas Strings
+	// Back up or restore only the schema.
+	SchemaOnly bool
 	// Specifies the size when splitting backup.sql files.
 	Split string
+	// Terminate sessions before dropping a database.
+	Terminate bool
+	// Connection string for the server -clone copies to.
+	To string
+	// Tables to restore.
+	Tables Strings
+	// Time limit for a single database.
+	Timeout time.Duration
+	// Percentage by which restored counts may differ.
+	Tolerance float64
+	// List file passed to pg_restore -L.
+	UseList string
+	// Vacuum databases after restore.
+	Vacuum bool
+	// Record counts on backup and compare them on restore.
+	Verify bool
 	// Print commands as they are executed.
 	Verbose bool
 	// Print version information and exit.
 	Version bool
+	// Answer yes to confirmations.
+	Yes bool
+	// Time to wait for the lock on the backups directory.
+	WaitLock time.Duration
 	// Any remaining flags after parsing.
 	Remaining []string
 }
+
+// Strings is a flag that can be given more than once; each value may also be a comma separated
+// list.
+type Strings []string
+
+// String returns the values as a comma separated list.
+func (s *Strings) String() string {
+	if s == nil {
+		return ""
+	}
+	return strings.Join(*s, ",")
+}
+
+// Set adds the comma separated values in value.
+func (s *Strings) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*s = append(*s, v)
+		}
+	}
+	return nil
+}
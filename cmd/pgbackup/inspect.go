@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dustin/go-humanize"
+
+	"pgbackup/psql"
+)
+
+// ExecInspect prints the table of contents of the backup of each database named on the command
+// line without restoring it.
+func (app *App) ExecInspect() {
+	var tocs = map[string]psql.TOC{}
+	var failed bool
+	//
+	if len(app.Args.Remaining) == 0 {
+		app.Errorf("-inspect expects the names of one or more backups")
+		os.Exit(255)
+	}
+	for _, dbname := range app.Args.Remaining {
+		db := psql.DB{
+			DBName: dbname,
+			PSQL:   app.PSQLFor(dbname),
+		}
+		toc, err := db.Inspect(app.Ctx, app.BackupFormat(dbname))
+		if err != nil {
+			app.Errorf("Unable to inspect %v: %v", dbname, err)
+			failed = true
+			continue
+		}
+		tocs[dbname] = toc
+		if !app.Args.JSON {
+			app.PrintTOC(dbname, toc)
+		}
+	}
+	//
+	if app.Args.JSON {
+		buf, err := json.MarshalIndent(tocs, "", "  ")
+		app.Error(err)
+		fmt.Println(string(buf))
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// BackupFormat returns the format of the backup of dbname; if the backup does not exist in the
+// configured format but exists in the other then the other is returned.
+func (app *App) BackupFormat(dbname string) psql.Format {
+	settings := app.SettingsFor(dbname)
+	exists := func(ext string) bool {
+		_, err := os.Stat(filepath.Join(app.Paths.Backups, settings.Content.Name(dbname)+ext))
+		return err == nil
+	}
+	switch settings.Format {
+	case psql.Directory:
+		if !exists(".backup") && (exists(".sql") || exists(".chunk")) {
+			return psql.Script
+		}
+	case psql.Script:
+		if !exists(".sql") && !exists(".chunk") && exists(".backup") {
+			return psql.Directory
+		}
+	}
+	return settings.Format
+}
+
+// PrintTOC prints a table of contents as a table followed by the number of entries of each type.
+func (app *App) PrintTOC(dbname string, toc psql.TOC) {
+	var buf bytes.Buffer
+	var types []string
+	var counts = map[string]int{}
+	var total int64
+	//
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTYPE\tSCHEMA\tNAME\tOWNER\tSIZE")
+	for _, entry := range toc {
+		size := ""
+		if entry.Size > 0 {
+			size = humanize.IBytes(uint64(entry.Size))
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", entry.ID, entry.Type, entry.Schema, entry.Name, entry.Owner, size)
+		if counts[entry.Type] == 0 {
+			types = append(types, entry.Type)
+		}
+		counts[entry.Type]++
+		total += entry.Size
+	}
+	w.Flush()
+	//
+	app.Infof("%v", dbname)
+	for _, line := range strings.Split(strings.TrimRight(buf.String(), "\n"), "\n") {
+		app.Infof("%v", line)
+	}
+	summary := make([]string, 0, len(types))
+	for _, typ := range types {
+		summary = append(summary, fmt.Sprintf("%v %v", counts[typ], typ))
+	}
+	app.Infof("%v entries (%v); %v of data", len(toc), strings.Join(summary, ", "), humanize.IBytes(uint64(total)))
+}
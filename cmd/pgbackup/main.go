@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"pgbackup/logger"
 	"pgbackup/psql"
@@ -37,31 +38,191 @@ func main() {
 			Format: psql.Directory,
 		},
 		Files: Files{
-			Binary: filepath.Base(exe),
+			Binary:  filepath.Base(exe),
+			Conf:    filepath.Join(home, "pgbackup.json"),
+			Lock:    filepath.Join(backups, ".pgbackup.lock"),
+			History: filepath.Join(backups, "drill-history.jsonl"),
 		},
 		Paths: Paths{
-			Home:    home,
-			Backups: backups,
+			Home:       home,
+			Backups:    backups,
+			PreRestore: filepath.Join(backups, "pre-restore"),
 		},
 		Logger: &logger.STDOut{},
 	}
+	flag.BoolVar(&app.Args.Analyze, "analyze", true, "Run ANALYZE in each database after -restore; use -analyze=false to skip it.")
 	flag.BoolVar(&app.Args.Backup, "backup", false, "Backup all databases or specified databases.")
 	flag.BoolVar(&app.Args.Clear, "clear", false, "Clear all backups from disk.")
 	describe = `
+Clone the specified databases from the -from server to the -to server without
+writing to disk; pg_dump is piped straight into pg_restore.
+    Use src:dst to clone src into the database dst.
+`
+	flag.BoolVar(&app.Args.Clone, "clone", false, strings.TrimSpace(describe))
+	describe = `
+Path to the JSON configuration file; defaults to pgbackup.json beside the binary
+which is optional.
+`
+	flag.StringVar(&app.Args.Config, "config", "", strings.TrimSpace(describe))
+	describe = `
+Back up or restore only the data of each database.  Backups are named
+dbname.data.backup or dbname.data.sql and are restored into the existing
+database without dropping it; restore the schema first with -schema-only.
+`
+	flag.BoolVar(&app.Args.DataOnly, "data-only", false, strings.TrimSpace(describe))
+	describe = `
+How table data is written to SQL script backups.
+    column-inserts  INSERT statements naming their columns; restores into tables
+                    whose columns are in a different order.
+    inserts         INSERT statements without column names.
+    copy            COPY statements; much smaller and faster to restore.
+`
+	flag.StringVar(&app.Args.DataStyle, "data-style", psql.ColumnInserts.String(), strings.TrimSpace(describe))
+	describe = `
+No further databases are started for backup or restore after the deadline;
+those already running are allowed to finish.
+    Use a duration such as 5h30m to set the deadline relative to the start.
+    Use a clock time such as 06:00 to set the deadline at the next occurrence
+    of that time.
+`
+	flag.StringVar(&app.Args.Deadline, "deadline", "", strings.TrimSpace(describe))
+	describe = `
+Compare the schema in the backup of each specified database with the schema of
+the live database dumped with pg_dump --schema-only.  Differences are printed as
+a unified diff grouped by object type; comments, settings and owners in headers
+are ignored.  Exits with 1 if any schema differs and 2 if a comparison fails.
+    With -schema-only the schema-only backups are compared.
+`
+	flag.BoolVar(&app.Args.DiffSchema, "diff-schema", false, strings.TrimSpace(describe))
+	describe = `
+Print the plan for -backup, -restore or -clear including every psql, pg_dump and
+pg_restore command and file removal without running any of them.  The list of
+databases is still read from the server when needed.
+`
+	flag.BoolVar(&app.Args.DryRun, "dry-run", false, strings.TrimSpace(describe))
+	describe = `
+Restore drill for all databases or specified databases; each backup is restored
+into a scratch database named pgbackup_drill_dbname, compared with the counts
+recorded at backup time, checked with the assertions in the configuration file,
+and dropped.  Outcomes are appended to backups/drill-history.jsonl.
+`
+	flag.BoolVar(&app.Args.Drill, "drill", false, strings.TrimSpace(describe))
+	describe = `
+Table that -restore skips along with its data, constraints, and privileges; may be
+given more than once or as a comma separated list.  Names may be qualified with a
+schema as in public.audit.  Implies a selective restore; see -table.
+`
+	flag.Var(&app.Args.ExcludeTables, "exclude-table", strings.TrimSpace(describe))
+	describe = `
 Specify backup or restore format.
     dir     Backups are created as directories; restores occur from existing directories.
     sql     Backups are created as SQL script files; restores occur from existing files.
 `
 	flag.StringVar(&app.Args.Format, "format", FlagFormatDirectory, strings.TrimSpace(describe))
+	describe = `
+Connection string or URI of the server -clone copies from, such as
+"host=prod port=5432 user=backup"; the default connects as psql does.  Keep
+passwords in a password file as commands are logged.
+`
+	flag.StringVar(&app.Args.From, "from", "", strings.TrimSpace(describe))
+	describe = `
+Time allowed for cleanup after SIGINT, SIGTERM or SIGHUP before the application
+exits; a second signal exits immediately.
+`
+	flag.DurationVar(&app.Args.Grace, "grace", 30*time.Second, strings.TrimSpace(describe))
 	flag.BoolVar(&app.Args.Help, "h", false, "")
 	flag.BoolVar(&app.Args.Help, "help", false, "Print help and exit.")
 	describe = `
+-restore and -drill refuse backups taken from a newer major version of PostgreSQL
+or that use extensions the server does not have; when enabled they only warn.
+`
+	flag.BoolVar(&app.Args.IgnoreCompat, "ignore-compat", false, strings.TrimSpace(describe))
+	describe = `
+Print the table of contents of the backups of the specified databases without
+restoring them; entries with data are shown with their sizes.  Directory backups
+are listed with pg_restore -l and SQL scripts are scanned for the objects they
+create.
+`
+	flag.BoolVar(&app.Args.Inspect, "inspect", false, strings.TrimSpace(describe))
+	flag.BoolVar(&app.Args.JSON, "json", false, "Print -inspect output as JSON.")
+	describe = `
 When enabled this flag tells -restore to use the split SQL scripts as data sources.
 `
 	flag.BoolVar(&app.Args.Join, "join", false, strings.TrimSpace(describe))
 	flag.BoolVar(&app.Args.List, "list", false, "List all databases that will be backed up.")
+	describe = `
+Role mapping for -restore as old=new; owners and grantees named old in backups
+are replaced by new.  May be given more than once or as a comma separated list
+and adds to the roles in the configuration file.
+`
+	flag.Var(&app.Args.MapRoles, "map-role", strings.TrimSpace(describe))
+	describe = `
+Mask the data of SQL script backups for development copies with the masks in the
+configuration file; a column is set to null, a fixed value, a hash or a made up
+email address, and a table can be truncated.
+    With -backup a masked copy is written beside each backup as
+    dbname.masked.sql and split like it; restore it with dbname.masked:dbname.
+    With -restore the data is masked as it is restored.
+`
+	flag.BoolVar(&app.Args.Mask, "mask", false, strings.TrimSpace(describe))
+	describe = `
+When enabled -restore restores objects owned by the user running the restore
+instead of their original owners.
+`
+	flag.BoolVar(&app.Args.NoOwner, "no-owner", false, strings.TrimSpace(describe))
+	flag.BoolVar(&app.Args.NoPrivileges, "no-privileges", false, "When enabled -restore skips grants and revokes.")
+	describe = `
+When enabled -restore takes a safety backup of each existing database before
+replacing it.  Safety backups are written to backups/pre-restore/dbname/<time>
+in directory format and can be restored with pg_restore.
+`
+	flag.BoolVar(&app.Args.PreBackup, "pre-backup", false, strings.TrimSpace(describe))
+	flag.IntVar(&app.Args.PreBackupKeep, "pre-backup-keep", 3, "Number of safety backups kept for each database; 0 keeps all of them.")
 	flag.StringVar(&app.Args.Regexp, "regexp", ".*", "Optional regexp used to match targets for backup or restore.")
-	flag.BoolVar(&app.Args.Restore, "restore", false, "Restore all databases or specified databases.")
+	describe = `
+Pattern for naming databases during -restore; every * is replaced by the name of
+the backup, e.g. -rename "*_check" restores orders into orders_check.  A single
+database can also be renamed with -restore orders:orders_check.
+`
+	flag.StringVar(&app.Args.Rename, "rename", "", strings.TrimSpace(describe))
+	describe = `
+Restore all databases or specified databases.
+    Use src:dst to restore the backup of src into the database dst.
+`
+	flag.BoolVar(&app.Args.Restore, "restore", false, strings.TrimSpace(describe))
+	describe = `
+Number of rows in each INSERT statement of SQL script backups written with
+-data-style inserts or column-inserts; the default of 1 writes a statement per row.
+`
+	flag.IntVar(&app.Args.RowsPerInsert, "rows-per-insert", 1, strings.TrimSpace(describe))
+	describe = `
+Number of times a failed backup or restore is retried.
+    Only failures caused by lost or refused connections are retried.
+`
+	flag.IntVar(&app.Args.Retries, "retries", 0, strings.TrimSpace(describe))
+	describe = `
+Delay before the first retry; the delay doubles after each failed attempt
+and is randomly jittered.
+`
+	flag.DurationVar(&app.Args.RetryDelay, "retry-delay", 10*time.Second, strings.TrimSpace(describe))
+	flag.DurationVar(&app.Args.RetryMaxDelay, "retry-max-delay", 5*time.Minute, "Maximum delay between retries.")
+	describe = `
+Schema that -restore is limited to; may be given more than once or as a comma
+separated list.  Implies a selective restore; see -table.
+`
+	flag.Var(&app.Args.Schemas, "schema", strings.TrimSpace(describe))
+	describe = `
+Back up or restore only the schema of each database.  Backups are named
+dbname.schema.backup or dbname.schema.sql beside the full backups.
+`
+	flag.BoolVar(&app.Args.SchemaOnly, "schema-only", false, strings.TrimSpace(describe))
+	flag.IntVar(&app.Args.Sample, "sample", 0, "Number of backups -drill picks at random; the default of 0 drills all of them.")
+	describe = `
+When enabled -restore restores each database into a scratch database first and
+only replaces the original once the restore succeeds.  The original is renamed
+with a date and time suffix and kept until it is dropped by hand.
+`
+	flag.BoolVar(&app.Args.Safe, "safe", false, strings.TrimSpace(describe))
 	describe = `
 Splits SQL script files into numbered parts of -split size in bytes.
     Use KiB, MiB, and GiB for sizes in powers of 1024.
@@ -69,9 +230,59 @@ Splits SQL script files into numbered parts of -split size in bytes.
     Only valid when "-backup -format sql" are also set and ignored otherwise.
 `
 	flag.StringVar(&app.Args.Split, "split", "8MiB", strings.TrimSpace(describe))
+	describe = `
+Table that -restore is limited to along with its data, constraints, and privileges;
+may be given more than once or as a comma separated list.  Names may be qualified
+with a schema as in public.users.
+    A selective restore goes into the existing database without dropping it.
+`
+	flag.Var(&app.Args.Tables, "table", strings.TrimSpace(describe))
+	describe = `
+When enabled -restore blocks new connections to each database and terminates
+the sessions connected to it before it is dropped; terminated sessions are
+reported.  DROP DATABASE ... WITH (FORCE) is used on Postgres 13 and later.
+`
+	flag.BoolVar(&app.Args.Terminate, "terminate", false, strings.TrimSpace(describe))
+	describe = `
+Time limit for the backup or restore of a single database; pg_dump, pg_restore
+or psql is killed when it is exceeded.  The default of 0 means no limit.
+`
+	flag.DurationVar(&app.Args.Timeout, "timeout", 0, strings.TrimSpace(describe))
+	flag.StringVar(&app.Args.To, "to", "", "Connection string or URI of the server -clone copies to; see -from.")
+	describe = `
+Percentage by which the counts compared by -verify may differ from the backup;
+the default of 0 requires them to match exactly.
+`
+	flag.Float64Var(&app.Args.Tolerance, "tolerance", 0, strings.TrimSpace(describe))
+	describe = `
+List file that selects the entries -restore restores from directory backups; it
+is passed to pg_restore -L.  Create it with pg_restore -l backups/dbname.backup
+and comment out or remove entries by hand.  The list is checked against each
+backup before anything is dropped, and backups in other formats are refused.
+`
+	flag.StringVar(&app.Args.UseList, "use-list", "", strings.TrimSpace(describe))
+	flag.BoolVar(&app.Args.Vacuum, "vacuum", false, "Run VACUUM ANALYZE in each database after -restore.")
+	describe = `
+With -backup the rows in every table are counted and recorded beside the backup
+in dbname.meta.json along with the number of objects of each kind.  With -restore
+the objects and rows of each restored database are compared with those recorded
+and the restore fails if they differ by more than -tolerance.  Counting reads
+every table in full; the counts are taken in the snapshot the backup is dumped in.
+`
+	flag.BoolVar(&app.Args.Verify, "verify", false, strings.TrimSpace(describe))
 	flag.BoolVar(&app.Args.Verbose, "verbose", false, "Print psql commands as they are executed.")
 	flag.BoolVar(&app.Args.Version, "v", false, "Print version information and exit.")
 	flag.BoolVar(&app.Args.Version, "version", false, "Print version information and exit.")
+	describe = `
+-backup, -restore and -clear lock the backups directory; this is how long to wait
+for another process to release the lock.  The default of 0 fails immediately.
+`
+	flag.DurationVar(&app.Args.WaitLock, "wait-lock", 0, strings.TrimSpace(describe))
+	describe = `
+Do not ask for confirmation before -restore replaces existing databases; required
+when -restore is not run from a terminal.
+`
+	flag.BoolVar(&app.Args.Yes, "yes", false, strings.TrimSpace(describe))
 	flag.Parse()
 	app.Args.Remaining = flag.Args()
 	if flag.NFlag() == 0 {
@@ -81,8 +292,38 @@ Splits SQL script files into numbered parts of -split size in bytes.
 		flag.PrintDefaults()
 		os.Exit(0)
 	}
+	if app.Args.Config != "" {
+		app.Files.Conf = app.Args.Config
+	}
+	file, err := LoadConfFile(app.Files.Conf, app.Args.Config != "")
+	if err != nil {
+		app.Infof("Unable to load configuration: %v", err)
+		os.Exit(255)
+	}
+	file.Apply(&app.Conf)
 	flag.Visit(func(f *flag.Flag) {
 		switch f.Name {
+		case "data-style":
+			switch f.Value.String() {
+			case psql.ColumnInserts.String():
+				app.Conf.DataStyle = psql.ColumnInserts
+			case psql.Copy.String():
+				app.Conf.DataStyle = psql.Copy
+			case psql.Inserts.String():
+				app.Conf.DataStyle = psql.Inserts
+			default:
+				app.Infof("-data-style expected to be one of: %v, %v, %v", psql.ColumnInserts, psql.Inserts, psql.Copy)
+				os.Exit(255)
+			}
+
+		case "deadline":
+			deadline, err := ParseDeadline(f.Value.String(), time.Now())
+			if err != nil {
+				app.Infof("-deadline %v is invalid: %v", f.Value.String(), err)
+				os.Exit(255)
+			}
+			app.Conf.Deadline = deadline
+
 		case "format":
 			switch f.Value.String() {
 			case FlagFormatDirectory:
@@ -106,6 +347,26 @@ Splits SQL script files into numbered parts of -split size in bytes.
 			}
 			app.Conf.Regexp = re
 
+		case "rename":
+			app.Conf.Rename = f.Value.String()
+
+		case "retries":
+			if app.Args.Retries < 0 {
+				app.Infof("-retries must not be negative")
+				os.Exit(255)
+			}
+
+		case "use-list":
+			list, err := filepath.Abs(f.Value.String())
+			if err != nil {
+				app.Infof("-use-list %v is invalid: %v", f.Value.String(), err)
+				os.Exit(255)
+			}
+			app.Conf.ListFile = list
+
+		case "timeout":
+			app.Conf.Timeout = app.Args.Timeout
+
 		case "split":
 			split := f.Value.String()
 			if split == "" {
@@ -119,5 +380,120 @@ Splits SQL script files into numbered parts of -split size in bytes.
 			app.Conf.SplitSize = int(parsed)
 		}
 	})
+	app.Conf.DryRun = app.Args.DryRun
+	app.Conf.Filter = psql.Filter{
+		Schemas:       app.Args.Schemas,
+		Tables:        app.Args.Tables,
+		ExcludeTables: app.Args.ExcludeTables,
+	}
+	if app.Args.SchemaOnly && app.Args.DataOnly {
+		app.Infof("-schema-only and -data-only are mutually exclusive")
+		os.Exit(255)
+	} else if (app.Args.SchemaOnly || app.Args.DataOnly) && !app.Args.Backup && !app.Args.Restore && !app.Args.Inspect && !app.Args.DiffSchema {
+		app.Infof("-schema-only and -data-only are only valid with -backup, -restore, -inspect and -diff-schema")
+		os.Exit(255)
+	} else if app.Args.DataOnly && app.Args.DiffSchema {
+		app.Infof("-data-only is only valid without -diff-schema")
+		os.Exit(255)
+	} else if app.Args.DataOnly && app.Args.Safe {
+		app.Infof("-data-only is only valid without -safe")
+		os.Exit(255)
+	} else if app.Args.SchemaOnly {
+		app.Conf.Content = psql.SchemaOnly
+	} else if app.Args.DataOnly {
+		app.Conf.Content = psql.DataOnly
+	}
+	if !app.Conf.Filter.IsZero() && (!app.Args.Restore || app.Args.Safe) {
+		app.Infof("-schema, -table and -exclude-table are only valid with -restore and without -safe")
+		os.Exit(255)
+	}
+	if app.Conf.ListFile != "" && (!app.Args.Restore || !app.Conf.Filter.IsZero()) {
+		app.Infof("-use-list is only valid with -restore and without -schema, -table and -exclude-table")
+		os.Exit(255)
+	}
+	for _, mapping := range app.Args.MapRoles {
+		k := strings.Index(mapping, "=")
+		if k <= 0 || k == len(mapping)-1 {
+			app.Infof("-map-role %v is invalid; expected old=new", mapping)
+			os.Exit(255)
+		}
+		app.Conf.Roles[mapping[:k]] = mapping[k+1:]
+	}
+	if app.Args.RowsPerInsert < 1 {
+		app.Infof("-rows-per-insert must be at least 1")
+		os.Exit(255)
+	} else if app.Args.RowsPerInsert > 1 && app.Conf.DataStyle == psql.Copy {
+		app.Infof("-rows-per-insert is only valid with -data-style inserts or column-inserts")
+		os.Exit(255)
+	}
+	app.Conf.RowsPerInsert = app.Args.RowsPerInsert
+	masks := len(app.Conf.Masks)
+	for _, db := range app.Conf.Databases {
+		masks += len(db.Masks)
+	}
+	if app.Args.Mask && !app.Args.Backup && !app.Args.Restore {
+		app.Infof("-mask is only valid with -backup and -restore")
+		os.Exit(255)
+	} else if app.Args.Mask && masks == 0 {
+		app.Infof("-mask requires masks in the configuration file")
+		os.Exit(255)
+	} else if app.Args.Mask && app.Args.Restore && app.Args.Verify {
+		app.Infof("-verify is only valid with -restore without -mask; masked tables may be truncated")
+		os.Exit(255)
+	}
+	app.Conf.Mask = app.Args.Mask
+	app.Conf.IgnoreCompat = app.Args.IgnoreCompat
+	app.Conf.NoOwner = app.Args.NoOwner
+	app.Conf.NoPrivileges = app.Args.NoPrivileges
+	if (app.Args.From != "" || app.Args.To != "") && !app.Args.Clone {
+		app.Infof("-from and -to are only valid with -clone")
+		os.Exit(255)
+	} else if app.Args.Clone && app.Args.Verify {
+		app.Infof("-verify is only valid with -backup, -restore and -drill")
+		os.Exit(255)
+	}
+	app.Conf.CloneFrom = app.Args.From
+	app.Conf.CloneTo = app.Args.To
+	if app.Args.Sample < 0 {
+		app.Infof("-sample must not be negative")
+		os.Exit(255)
+	}
+	if app.Args.Tolerance < 0 {
+		app.Infof("-tolerance must not be negative")
+		os.Exit(255)
+	}
+	app.Conf.Analyze = app.Args.Analyze
+	app.Conf.Vacuum = app.Args.Vacuum
+	app.Conf.Verify = app.Args.Verify
+	app.Conf.Tolerance = app.Args.Tolerance
+	app.Conf.Grace = app.Args.Grace
+	app.Conf.PreBackup = app.Args.PreBackup
+	app.Conf.PreBackupKeep = app.Args.PreBackupKeep
+	app.Conf.Safe = app.Args.Safe
+	app.Conf.Terminate = app.Args.Terminate
+	app.Conf.Yes = app.Args.Yes
+	app.Conf.WaitLock = app.Args.WaitLock
+	app.Conf.Retry = psql.Retry{
+		Attempts: app.Args.Retries + 1,
+		Delay:    app.Args.RetryDelay,
+		MaxDelay: app.Args.RetryMaxDelay,
+	}
 	app.Run()
 }
+
+// ParseDeadline parses s as either a duration relative to now or a clock time in 15:04 format;
+// a clock time that has already passed today refers to tomorrow.
+func ParseDeadline(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(d), nil
+	}
+	clock, err := time.ParseInLocation("15:04", s, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected a duration or a clock time such as 06:00")
+	}
+	rv := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !rv.After(now) {
+		rv = rv.AddDate(0, 0, 1)
+	}
+	return rv, nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"path/filepath"
+
+	"pgbackup/psql"
+)
+
+// MaskBackup writes the masked copy of the backup of db with -mask and splits it like the
+// backup.  Only SQL script backups are masked.
+func (app *App) MaskBackup(db psql.DB, settings Settings) error {
+	if !app.Conf.Mask {
+		return nil
+	} else if settings.Format != psql.Script {
+		app.Warningf("\t%v was not masked; only SQL script backups are masked", db.DBName)
+		app.Report.Note(db.DBName, "not masked; only SQL script backups are masked")
+		return nil
+	} else if len(settings.Masks) == 0 {
+		app.Report.Note(db.DBName, "not masked; no masks apply to it")
+		return nil
+	}
+	masked, err := db.Mask()
+	if err != nil {
+		return err
+	} else if settings.SplitSize > 0 {
+		if err = db.Chunk(masked, settings.SplitSize); err != nil {
+			return err
+		}
+	}
+	app.Report.Note(db.DBName, "masked copy written to %v", filepath.Base(masked))
+	return nil
+}
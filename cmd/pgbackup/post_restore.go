@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"pgbackup/psql"
+)
+
+// RecordMeta writes the metadata of the backup of dbname including the server and pg_dump that
+// produced it; with -verify the rows in every table are counted so a restore can be checked
+// against them.  The counts are taken in snapshot, the snapshot the backup was dumped in, if it
+// is not nil.
+func (app *App) RecordMeta(ctx context.Context, dbname string, snapshot *psql.Snapshot) error {
+	settings := app.SettingsFor(dbname)
+	db := psql.DB{
+		DBName:   dbname,
+		Snapshot: snapshot,
+		PSQL:     app.PSQLFor(dbname),
+	}
+	server, err := db.Server(ctx, dbname)
+	if err != nil {
+		return err
+	}
+	// A schema-only backup holds no rows to compare.
+	counts, err := db.Counts(ctx, dbname, app.Conf.Verify && settings.Content != psql.SchemaOnly)
+	if err != nil {
+		return err
+	}
+	meta := psql.Meta{
+		Database: dbname,
+		Format:   settings.Format.String(),
+		Created:  time.Now(),
+		Server:   server,
+		Counts:   counts,
+	}
+	if settings.Content != psql.Full {
+		meta.Content = settings.Content.String()
+	}
+	if settings.Format == psql.Script {
+		meta.DataStyle = app.Conf.DataStyle.String()
+		if app.Conf.RowsPerInsert > 1 {
+			meta.RowsPerInsert = app.Conf.RowsPerInsert
+		}
+	}
+	return db.WriteMeta(meta)
+}
+
+// PostRestore runs after the backup of dbname has been restored into target.  It rebuilds the
+// planner statistics with ANALYZE or VACUUM ANALYZE and with -verify compares the objects and
+// rows in target with those recorded in the metadata of the backup.
+func (app *App) PostRestore(ctx context.Context, dbname string, target string) error {
+	db := psql.DB{
+		DBName: dbname,
+		PSQL:   app.PSQL,
+	}
+	if app.Conf.Analyze || app.Conf.Vacuum {
+		if err := db.Analyze(ctx, target, app.Conf.Vacuum); err != nil {
+			return fmt.Errorf("analyze of %v: %w", target, err)
+		}
+	}
+	if !app.Conf.Verify {
+		return nil
+	} else if !app.Conf.Filter.IsZero() || app.Conf.ListFile != "" {
+		app.Report.Note(dbname, "not verified; selective restores are not compared with the backup")
+		return nil
+	}
+	return app.Verify(ctx, dbname, target, false)
+}
+
+// Verify compares the objects and rows in target with those recorded in the metadata of the
+// backup of dbname.  A backup without metadata is only an error when required is true.
+func (app *App) Verify(ctx context.Context, dbname string, target string, required bool) error {
+	db := psql.DB{
+		DBName: dbname,
+		PSQL:   app.PSQLFor(dbname),
+	}
+	meta, err := db.ReadMeta()
+	if os.IsNotExist(err) && !app.Conf.DryRun {
+		if required {
+			return fmt.Errorf("the backup of %v has no recorded counts", dbname)
+		}
+		app.Warningf("\t%v was not verified; the backup has no recorded counts", dbname)
+		app.Report.Note(dbname, "not verified; the backup has no recorded counts")
+		return nil
+	} else if err != nil && !app.Conf.DryRun {
+		return err
+	}
+	have, err := db.Counts(ctx, target, len(meta.Rows) > 0 || app.Conf.DryRun)
+	if err != nil || app.Conf.DryRun {
+		return err
+	}
+	if diffs := meta.Compare(have, app.Conf.Tolerance); len(diffs) > 0 {
+		for _, diff := range diffs {
+			app.Warningf("\t%v: %v", target, diff)
+		}
+		return fmt.Errorf("%v counts differ from the backup by more than %v%%", len(diffs), app.Conf.Tolerance)
+	}
+	app.Report.Note(dbname, "verified %v kinds of objects and %v tables against the backup", len(meta.Objects), len(meta.Rows))
+	return nil
+}
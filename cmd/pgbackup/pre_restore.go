@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"pgbackup/psql"
+)
+
+// CheckServer checks that the backup of dbname can be restored into the server using the server
+// and extensions recorded in its metadata.  Restoring into an older major version or a server
+// missing an extension fails unless -ignore-compat is set; other differences are warnings.
+func (app *App) CheckServer(ctx context.Context, dbname string) error {
+	db := psql.DB{
+		DBName: dbname,
+		PSQL:   app.PSQLFor(dbname),
+	}
+	meta, err := db.ReadMeta()
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	version, err := db.ServerVersion(ctx)
+	if err != nil {
+		return err
+	}
+	available, err := db.AvailableExtensions(ctx)
+	if err != nil || app.Conf.DryRun {
+		return err
+	}
+	warnings, err := meta.Server.Check(version, available)
+	if err != nil && app.Conf.IgnoreCompat {
+		warnings, err = append(warnings, err.Error()), nil
+	}
+	for _, warning := range warnings {
+		app.Warningf("\t%v: %v", dbname, warning)
+		app.Report.Note(dbname, "%v", warning)
+	}
+	return err
+}
+
+// PreRestoreBackup backs up the existing database target before a restore replaces it.  The
+// backup is written in directory format to Paths.PreRestore/target/<timestamp>/ and older safety
+// backups of target beyond -pre-backup-keep are removed.
+//
+// The path of the backup is returned; it is empty if target does not exist.
+func (app *App) PreRestoreBackup(ctx context.Context, target string) (string, error) {
+	db := psql.DB{
+		DBName: target,
+		PSQL:   app.PSQL,
+	}
+	if exists, err := db.Exists(ctx, target); err != nil {
+		return "", err
+	} else if !exists && !app.Conf.DryRun {
+		return "", nil
+	}
+	//
+	dir := filepath.Join(app.Paths.PreRestore, target)
+	db.DirBackups = filepath.Join(dir, time.Now().Format("20060102_150405"))
+	if !app.Conf.DryRun {
+		if err := os.MkdirAll(db.DirBackups, 0770); err != nil {
+			return "", err
+		}
+	}
+	dst, err := db.Backup(ctx, psql.Directory)
+	if err != nil {
+		if !app.Conf.DryRun {
+			os.RemoveAll(db.DirBackups)
+		}
+		return "", err
+	}
+	//
+	app.PrunePreRestore(dir)
+	return dst, nil
+}
+
+// PrunePreRestore removes all but the newest -pre-backup-keep safety backups in dir.
+func (app *App) PrunePreRestore(dir string) {
+	if app.Conf.PreBackupKeep <= 0 || app.Conf.DryRun {
+		return
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		app.Warningf("While pruning %v: %v", dir, err)
+		return
+	}
+	var stamps []string
+	for _, info := range infos {
+		if info.IsDir() {
+			stamps = append(stamps, info.Name())
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(stamps)))
+	for k := app.Conf.PreBackupKeep; k < len(stamps); k++ {
+		path := filepath.Join(dir, stamps[k])
+		app.Infof("Removing old safety backup %v", path)
+		if err = os.RemoveAll(path); err != nil {
+			app.Warningf("%v", err)
+		}
+	}
+}
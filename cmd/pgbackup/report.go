@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"pgbackup/logger"
+)
+
+// Status is the outcome of work on a single database.
+type Status string
+
+const (
+	// The work completed successfully.
+	StatusOK Status = "ok"
+	// The work failed.
+	StatusFailed Status = "failed"
+	// The work was never started because the deadline passed or the application was interrupted.
+	StatusSkipped Status = "skipped"
+	// The work was interrupted by a signal.
+	StatusInterrupted Status = "interrupted"
+)
+
+// Result records the outcome of work on a single database.
+type Result struct {
+	Name     string
+	Status   Status
+	Error    string
+	Start    time.Time
+	Duration time.Duration
+	// Notes records noteworthy events such as safety backups.
+	Notes []string
+}
+
+// Report collects the results of a run.
+type Report struct {
+	Results []Result
+	//
+	mu      sync.Mutex
+	running map[string]struct{}
+	notes   map[string][]string
+}
+
+// Begin marks the named database as running.
+func (r *Report) Begin(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.running == nil {
+		r.running = map[string]struct{}{}
+	}
+	r.running[name] = struct{}{}
+}
+
+// End marks the named database as no longer running.
+func (r *Report) End(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.running, name)
+}
+
+// Running returns the sorted names of the databases currently running.
+func (r *Report) Running() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rv []string
+	for name := range r.running {
+		rv = append(rv, name)
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+// Note records a note for the named database; it is attached to the next result added for it.
+func (r *Report) Note(name string, format string, vals ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.notes == nil {
+		r.notes = map[string][]string{}
+	}
+	r.notes[name] = append(r.notes[name], fmt.Sprintf(format, vals...))
+}
+
+// Add adds a result to the report.
+func (r *Report) Add(result Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result.Notes = append(result.Notes, r.notes[result.Name]...)
+	delete(r.notes, result.Name)
+	r.Results = append(r.Results, result)
+}
+
+// Names returns the sorted names of the databases with the given status.
+func (r *Report) Names(status Status) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rv []string
+	for _, result := range r.Results {
+		if result.Status == status {
+			rv = append(rv, result.Name)
+		}
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+// Summarize logs a summary of the report.
+func (r *Report) Summarize(log logger.Logger) {
+	ok, failed := r.Names(StatusOK), r.Names(StatusFailed)
+	skipped, interrupted := r.Names(StatusSkipped), r.Names(StatusInterrupted)
+	if len(ok)+len(failed)+len(skipped)+len(interrupted) == 0 {
+		return
+	}
+	log.Infof("Summary: %v ok, %v failed, %v skipped, %v interrupted", len(ok), len(failed), len(skipped), len(interrupted))
+	if len(failed) > 0 {
+		log.Infof("\tFailed: %v", strings.Join(failed, ", "))
+	}
+	if len(skipped) > 0 {
+		log.Infof("\tSkipped: %v", strings.Join(skipped, ", "))
+	}
+	if len(interrupted) > 0 {
+		log.Infof("\tInterrupted: %v", strings.Join(interrupted, ", "))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, result := range r.Results {
+		for _, note := range result.Notes {
+			log.Infof("\t%v: %v", result.Name, note)
+		}
+	}
+}
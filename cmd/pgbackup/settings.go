@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"pgbackup/psql"
+	"pgbackup/script"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Settings are the effective settings for a single database: those from the command line with
+// the overrides for the database from the configuration file applied.
+type Settings struct {
+	// Format is the backup format.
+	Format psql.Format
+	// Content is what backups hold.
+	Content psql.Content
+	// SplitSize is the size in bytes of the parts of SQL script backups; if 0 or less then no
+	// splitting occurs.
+	SplitSize int
+	// Jobs is the number of jobs of pg_dump and pg_restore for directory backups.
+	Jobs int
+	// Compression is passed to pg_dump -Z for directory backups; if empty the pg_dump default is
+	// used.
+	Compression string
+	// Timeout limits the time spent on the database; if 0 or less there is no limit.
+	Timeout time.Duration
+	// Args maps psql, pg_dump, and pg_restore to extra arguments passed to them.
+	Args map[string][]string
+	// Masks are the rules masking the data of SQL script backups.
+	Masks script.Masks
+}
+
+// String describes the settings.
+func (s Settings) String() string {
+	parts := []string{"format " + s.Format.String()}
+	if s.Content != psql.Full {
+		parts = append(parts, s.Content.String()+" only")
+	}
+	if s.Format == psql.Script && s.SplitSize > 0 {
+		parts = append(parts, "split "+humanize.IBytes(uint64(s.SplitSize)))
+	} else if s.Format == psql.Directory {
+		parts = append(parts, fmt.Sprintf("%v jobs", s.Jobs))
+	}
+	if s.Format == psql.Directory && s.Compression != "" {
+		parts = append(parts, "compression "+s.Compression)
+	}
+	if s.Timeout > 0 {
+		parts = append(parts, fmt.Sprintf("timeout %v", s.Timeout))
+	}
+	for _, tool := range Tools {
+		if len(s.Args[tool]) > 0 {
+			parts = append(parts, tool+" "+strings.Join(s.Args[tool], " "))
+		}
+	}
+	if len(s.Masks) > 0 {
+		parts = append(parts, fmt.Sprintf("%v masks", len(s.Masks)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// SettingsFor returns the effective settings for dbname.  The entries in Conf.Databases that
+// apply to dbname override the command line in turn except for extra arguments which are added
+// after those configured for every database.
+func (app *App) SettingsFor(dbname string) Settings {
+	rv := Settings{
+		Format:    app.Conf.Format,
+		Content:   app.Conf.Content,
+		SplitSize: app.Conf.SplitSize,
+		Jobs:      app.Jobs,
+		Timeout:   app.Conf.Timeout,
+		Args:      copyArgs(app.Conf.Args),
+		Masks:     script.Masks{},
+	}
+	for name, rule := range app.Conf.Masks {
+		rv.Masks[name] = rule
+	}
+	for _, db := range app.Conf.DatabasesFor(dbname) {
+		// Entries were checked when the configuration file was loaded.
+		_ = db.Apply(&rv)
+	}
+	return rv
+}
+
+// PSQLFor returns the PSQL used for the tools run for dbname; it carries the content, jobs,
+// compression, and extra arguments in the settings for dbname and with -mask its masks.
+func (app *App) PSQLFor(dbname string) psql.PSQL {
+	settings := app.SettingsFor(dbname)
+	rv := app.PSQL
+	rv.Content = settings.Content
+	rv.Jobs = settings.Jobs
+	rv.Compression = settings.Compression
+	rv.Args = settings.Args
+	if app.Conf.Mask {
+		rv.Masks = settings.Masks
+	}
+	return rv
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Work calls fn for each of names across app.Ops concurrent workers and records the outcome
+// of each call in app.Report.
+//
+// Each call to fn is given a context that expires after the timeout in the settings for the
+// name.  Once the -deadline passes no further names are started but calls already in progress
+// are allowed to finish.
+func (app *App) Work(names []string, fn func(ctx context.Context, name string) error) {
+	namesCh := make(chan string, len(names))
+	for _, name := range names {
+		namesCh <- name
+	}
+	close(namesCh)
+	//
+	// A dry run prints its plan from a single worker so the output is not interleaved.
+	ops := app.Ops
+	if app.Conf.DryRun {
+		ops = 1
+	}
+	var wg sync.WaitGroup
+	for k := 0; k < ops; k++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case name, ok := <-namesCh:
+					if !ok {
+						return
+					} else if app.Ctx.Err() != nil {
+						app.Report.Add(Result{Name: name, Status: StatusSkipped, Error: "interrupted before start"})
+						continue
+					}
+					if deadline := app.Conf.Deadline; !deadline.IsZero() && time.Now().After(deadline) {
+						app.Warningf("Skipping %v; deadline passed at %v", name, deadline.Format("2006-01-02 15:04:05"))
+						app.Report.Add(Result{Name: name, Status: StatusSkipped})
+						continue
+					}
+					app.work(name, fn)
+
+				case <-app.Ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	//
+	// Anything left was never started because the application was interrupted.
+	for name := range namesCh {
+		app.Report.Add(Result{Name: name, Status: StatusSkipped, Error: "interrupted before start"})
+	}
+}
+
+// work calls fn for a single name under the per-database timeout.
+func (app *App) work(name string, fn func(ctx context.Context, name string) error) {
+	timeout := app.SettingsFor(name).Timeout
+	ctx, cancel := app.Ctx, func() {}
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(app.Ctx, timeout)
+	}
+	defer cancel()
+	//
+	app.Report.Begin(name)
+	defer app.Report.End(name)
+	//
+	result := Result{
+		Name:   name,
+		Status: StatusOK,
+		Start:  time.Now(),
+	}
+	err := fn(ctx, name)
+	result.Duration = time.Since(result.Start)
+	if err != nil && app.Ctx.Err() != nil {
+		app.Warningf("%v was interrupted", name)
+		result.Status, result.Error = StatusInterrupted, err.Error()
+	} else if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out after %v: %w", timeout, err)
+			app.Warningf("%v %v", name, err)
+		}
+		result.Status, result.Error = StatusFailed, err.Error()
+	}
+	app.Report.Add(result)
+}
@@ -0,0 +1,103 @@
+package pgbackup
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LockedError is returned by Lock when the lock is held by another process.
+type LockedError struct {
+	// Path to the lock file.
+	Path string
+	// PID of the process holding the lock; 0 if it could not be determined.
+	PID int
+}
+
+// Error returns the error message.
+func (e *LockedError) Error() string {
+	if e.PID == 0 {
+		return fmt.Sprintf("%v is locked by another process", e.Path)
+	}
+	return fmt.Sprintf("%v is locked by pid %v", e.Path, e.PID)
+}
+
+// LockFile is an exclusive advisory lock held on a file.
+type LockFile struct {
+	Path string
+	//
+	fd *os.File
+}
+
+// Lock takes an exclusive advisory lock on the file at path, creating it if necessary, and writes
+// the current PID into it.
+//
+// If the lock is held by another process Lock keeps trying until wait has elapsed or ctx is done
+// and then returns a *LockedError naming the PID of the holder.
+func Lock(ctx context.Context, path string, wait time.Duration) (*LockFile, error) {
+	fd, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0660)
+	if err != nil {
+		return nil, err
+	}
+	//
+	until := time.Now().Add(wait)
+	for {
+		var locked bool
+		if locked, err = flock(fd); err != nil {
+			fd.Close()
+			return nil, err
+		} else if locked {
+			break
+		} else if time.Now().After(until) || ctx.Err() != nil {
+			fd.Close()
+			return nil, &LockedError{Path: path, PID: lockPID(path)}
+		}
+		select {
+		case <-time.After(250 * time.Millisecond):
+		case <-ctx.Done():
+		}
+	}
+	//
+	if err = fd.Truncate(0); err == nil {
+		_, err = fd.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	if err != nil {
+		funlock(fd)
+		fd.Close()
+		return nil, err
+	}
+	return &LockFile{Path: path, fd: fd}, nil
+}
+
+// Unlock releases the lock.
+func (l *LockFile) Unlock() error {
+	if l == nil || l.fd == nil {
+		return nil
+	}
+	var err error
+	fd := l.fd
+	l.fd = nil
+	if err = fd.Truncate(0); err != nil {
+		funlock(fd)
+		fd.Close()
+		return err
+	} else if err = funlock(fd); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
+
+// lockPID returns the PID recorded in the lock file at path or 0 if it can not be read.
+func lockPID(path string) int {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(b)))
+	return pid
+}
@@ -0,0 +1,30 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package pgbackup
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// flock tries to take an exclusive lock on fd without blocking; it returns false if the lock
+// is held elsewhere.
+func flock(fd *os.File) (bool, error) {
+	for {
+		err := syscall.Flock(int(fd.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return true, nil
+		} else if errors.Is(err, syscall.EWOULDBLOCK) {
+			return false, nil
+		} else if !errors.Is(err, syscall.EINTR) {
+			return false, err
+		}
+	}
+}
+
+// funlock releases the lock on fd.
+func funlock(fd *os.File) error {
+	return syscall.Flock(int(fd.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,17 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package pgbackup
+
+import "os"
+
+// flock always succeeds because advisory locks are not supported on this platform; the
+// lock file still records the PID of the last process to take it.
+func flock(fd *os.File) (bool, error) {
+	return true, nil
+}
+
+// funlock is a no-op on this platform.
+func funlock(fd *os.File) error {
+	return nil
+}
@@ -0,0 +1,103 @@
+package psql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Denied lists the arguments of each tool that pgbackup controls itself; they cannot be given as
+// extra arguments.
+var Denied = map[string][]string{
+	"pg_dump": {
+		"-d", "--dbname", "-f", "--file", "-F", "--format", "-j", "--jobs",
+		"-h", "--host", "-p", "--port", "-U", "--username",
+		"--inserts", "--column-inserts", "--rows-per-insert", "-Z", "--compress",
+		"-s", "--schema-only", "-a", "--data-only", "--snapshot",
+	},
+	"pg_restore": {
+		"-d", "--dbname", "-f", "--file", "-F", "--format", "-j", "--jobs",
+		"-h", "--host", "-p", "--port", "-U", "--username",
+		"-l", "--list", "-L", "--use-list", "-C", "--create", "-c", "--clean",
+		"-O", "--no-owner", "-x", "--no-privileges", "--no-acl",
+	},
+	"psql": {
+		"-d", "--dbname", "-f", "--file", "-c", "--command",
+		"-h", "--host", "-p", "--port", "-U", "--username", "-l", "--list",
+	},
+}
+
+// Valued lists the options of each tool that take a value, either attached or as the next
+// argument.
+var Valued = map[string][]string{
+	"pg_dump": {
+		"-d", "--dbname", "-f", "--file", "-F", "--format", "-j", "--jobs",
+		"-h", "--host", "-p", "--port", "-U", "--username",
+		"-n", "--schema", "-N", "--exclude-schema", "-t", "--table", "-T", "--exclude-table",
+		"-e", "--extension", "-E", "--encoding", "-S", "--superuser", "-Z", "--compress",
+		"--exclude-extension", "--exclude-table-and-children", "--exclude-table-data",
+		"--exclude-table-data-and-children", "--extra-float-digits", "--filter",
+		"--include-foreign-data", "--lock-wait-timeout", "--role", "--rows-per-insert",
+		"--section", "--snapshot", "--sync-method", "--table-and-children",
+	},
+	"pg_restore": {
+		"-d", "--dbname", "-f", "--file", "-F", "--format", "-j", "--jobs",
+		"-h", "--host", "-p", "--port", "-U", "--username", "-L", "--use-list",
+		"-n", "--schema", "-N", "--exclude-schema", "-t", "--table", "-T", "--trigger",
+		"-I", "--index", "-P", "--function", "-S", "--superuser",
+		"--filter", "--role", "--section", "--transaction-size",
+	},
+	"psql": {
+		"-d", "--dbname", "-f", "--file", "-c", "--command",
+		"-h", "--host", "-p", "--port", "-U", "--username",
+		"-v", "--set", "--variable", "-P", "--pset", "-F", "--field-separator",
+		"-R", "--record-separator", "-T", "--table-attr", "-L", "--log-file", "-o", "--output",
+	},
+}
+
+// CheckArgs returns an error if args, the extra arguments for tool, include an argument in
+// Denied or an argument that is not an option or the value of one.  Short options are also
+// denied when bundled, as in -vs, or with their value attached, as in -fout.sql, and long options
+// with their value after =, as in --file=out.sql.
+func CheckArgs(tool string, args []string) error {
+	denied, ok := Denied[tool]
+	if !ok {
+		return fmt.Errorf("unknown tool %v", tool)
+	}
+	valued := Valued[tool]
+	for k := 0; k < len(args); k++ {
+		var value bool
+		arg := args[k]
+		if strings.HasPrefix(arg, "--") && arg != "--" {
+			name := arg
+			if n := strings.Index(arg, "="); n >= 0 {
+				name = arg[:n]
+			}
+			if contains(denied, name) {
+				return fmt.Errorf("%v %v is controlled by pgbackup", tool, arg)
+			}
+			value = name == arg && contains(valued, name)
+		} else if strings.HasPrefix(arg, "-") && arg != "-" && arg != "--" {
+			// Short options are bundled until one that takes a value; the rest is its value.
+			for n := 1; n < len(arg); n++ {
+				option := "-" + arg[n:n+1]
+				if contains(denied, option) && option == arg[:n+1] {
+					return fmt.Errorf("%v %v is controlled by pgbackup", tool, arg)
+				} else if contains(denied, option) {
+					return fmt.Errorf("%v %v is controlled by pgbackup; it is bundled in %v", tool, option, arg)
+				} else if contains(valued, option) {
+					value = n == len(arg)-1
+					break
+				}
+			}
+		} else {
+			return fmt.Errorf("%v %v is not an option; extra arguments are options and their values", tool, arg)
+		}
+		// A value in the next argument is skipped.
+		if value {
+			if k++; k == len(args) {
+				return fmt.Errorf("%v %v needs a value", tool, arg)
+			}
+		}
+	}
+	return nil
+}
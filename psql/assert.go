@@ -0,0 +1,17 @@
+package psql
+
+import (
+	"context"
+	"fmt"
+)
+
+// Assert runs the query sql in dbname; it fails unless the query returns a single true value.
+func (db DB) Assert(ctx context.Context, dbname string, sql string) error {
+	out, err := db.output(db.QueryDB(ctx, dbname, sql))
+	if err != nil {
+		return err
+	} else if out != "t" && !db.DryRun {
+		return fmt.Errorf("assertion %q returned %q", sql, out)
+	}
+	return nil
+}
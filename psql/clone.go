@@ -0,0 +1,105 @@
+package psql
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Clone copies the database DBName on the server of src into the target of DB without writing
+// to disk; pg_dump on src is piped straight into pg_restore.  The target is dropped and created
+// first.
+func (db DB) Clone(ctx context.Context, src PSQL) error {
+	_, err := db.Retry.Do(ctx, "Clone of "+db.DBName+" into "+db.target(), func() ([]byte, error) {
+		if out, err := db.clone(ctx, src); err != nil {
+			return out, err
+		} else if db.Check != nil {
+			return nil, db.Check(ctx, db.target())
+		}
+		return nil, nil
+	})
+	return err
+}
+
+// clone makes a single attempt at cloning DBName and returns the output of the commands that
+// failed.
+func (db DB) clone(ctx context.Context, src PSQL) ([]byte, error) {
+	var out []byte
+	var err error
+	//
+	target := db.target()
+	if out, err = db.dropDatabase(ctx, target); err != nil {
+		return out, err
+	}
+	if out, err = db.run(db.Create(ctx, target)); err != nil {
+		db.LogOutput(out)
+		return out, err
+	}
+	db.LogOutput(out)
+	//
+	// Either command failing kills the other.
+	pipeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	dump, restore := src.Dump(pipeCtx, db.DBName), db.RestoreArchive(pipeCtx, target)
+	if !db.DryRun {
+		if out, err = pipe(dump, restore, cancel); err != nil {
+			db.LogOutput(out)
+			return out, err
+		}
+		db.LogOutput(out)
+	}
+	//
+	if db.MapsRoles() {
+		return db.restoreRoles(ctx, src.DumpSchema(ctx, db.DBName), target, false)
+	}
+	return nil, nil
+}
+
+// pipe runs from with its stdout connected to the stdin of to and waits for both; if either
+// fails cancel is called to stop the other.  The stderr of both commands is returned.
+func pipe(from *exec.Cmd, to *exec.Cmd, cancel func()) ([]byte, error) {
+	var fromErr, toErr bytes.Buffer
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	from.Stdout, from.Stderr = w, &fromErr
+	to.Stdin, to.Stderr = r, &toErr
+	if err = to.Start(); err != nil {
+		r.Close()
+		w.Close()
+		return nil, err
+	}
+	if err = from.Start(); err != nil {
+		r.Close()
+		w.Close()
+		cancel()
+		to.Wait()
+		return toErr.Bytes(), err
+	}
+	// The commands hold their own ends of the pipe now.
+	r.Close()
+	w.Close()
+	//
+	// The first command to fail is the cause; the other was most likely killed because of it.
+	done := make(chan error, 2)
+	for _, cmd := range []*exec.Cmd{from, to} {
+		go func(cmd *exec.Cmd) {
+			err := cmd.Wait()
+			if err != nil {
+				cancel()
+				err = fmt.Errorf("%v: %w", filepath.Base(cmd.Path), err)
+			}
+			done <- err
+		}(cmd)
+	}
+	for k := 0; k < 2; k++ {
+		if waitErr := <-done; waitErr != nil && err == nil {
+			err = waitErr
+		}
+	}
+	return append(fromErr.Bytes(), toErr.Bytes()...), err
+}
@@ -0,0 +1,50 @@
+package psql
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Database describes an existing database.
+type Database struct {
+	Name string
+	// Size is the size of the database in bytes.
+	Size int64
+	// LastActivity is the latest activity among the sessions connected to the database; it is
+	// zero if no sessions are connected.
+	LastActivity time.Time
+}
+
+// Databases returns the databases among names that exist on the server, sorted by name.
+func (db DB) Databases(ctx context.Context, names []string) ([]Database, error) {
+	var rv []Database
+	if len(names) == 0 {
+		return nil, nil
+	}
+	//
+	var literals []string
+	for _, name := range names {
+		literals = append(literals, QuoteLiteral(name))
+	}
+	out, err := db.query(ctx, "select concat_ws('|', pg_database_size(d.oid),"+
+		" coalesce((select extract(epoch from max(coalesce(a.state_change, a.backend_start)))::bigint from pg_stat_activity a where a.datname = d.datname), 0),"+
+		" d.datname) from pg_database d where d.datname in ("+strings.Join(literals, ", ")+") order by d.datname")
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.SplitN(line, "|", 3)
+		if len(parts) < 3 {
+			continue
+		}
+		database := Database{Name: parts[2]}
+		database.Size, _ = strconv.ParseInt(parts[0], 10, 64)
+		if epoch, _ := strconv.ParseInt(parts[1], 10, 64); epoch > 0 {
+			database.LastActivity = time.Unix(epoch, 0)
+		}
+		rv = append(rv, database)
+	}
+	return rv, nil
+}
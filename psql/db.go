@@ -1,56 +1,110 @@
 package psql
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/nofeaturesonlybugs/fscopy"
 
 	"pgbackup"
 	"pgbackup/logger"
+	"pgbackup/script"
 )
 
 // DB links a dbname to a PSQL type.
 type DB struct {
 	DBName string
+	// Target is the database restored into from the backup of DBName; if empty it is DBName.
+	Target string
+	// Check, if not nil, is called with the database restored into once a restore succeeds;
+	// a safe restore calls it before the target is replaced.  An error fails the restore.
+	Check func(ctx context.Context, dbname string) error
+	// Snapshot, if not nil, is the session counts are taken in so they match a backup dumped in
+	// its snapshot.
+	Snapshot *Snapshot
 	PSQL
 }
 
 // Backup performs a backup of DB.
 func (db DB) Backup(ctx context.Context, format Format) (string, error) {
-	var cmd *exec.Cmd
+	dst, _, err := db.backup(ctx, format, false)
+	return dst, err
+}
+
+// BackupInSnapshot performs a backup of DB dumped in a snapshot exported for it and returns the
+// session holding the snapshot so queries see the rows in the backup; the caller closes it.  Each
+// attempt exports its own snapshot since the snapshot of a failed attempt may be gone.
+func (db DB) BackupInSnapshot(ctx context.Context, format Format) (string, *Snapshot, error) {
+	return db.backup(ctx, format, true)
+}
+
+// backup performs a backup of DB, in an exported snapshot if export is true.
+func (db DB) backup(ctx context.Context, format Format, export bool) (string, *Snapshot, error) {
 	var dst string
-	var out []byte
+	var snapshot *Snapshot
 	var err error
 	//
-	dst, cmd = db.PSQL.Backup(ctx, db.DBName, format)
-	//
-	// Before running cmd we have to remove anything currently existing at dst.
-	if _, err = os.Stat(dst); err == nil {
-		if err = os.RemoveAll(dst); err != nil {
-			return dst, err
+	_, err = db.Retry.Do(ctx, "Backup of "+db.DBName, func() ([]byte, error) {
+		var cmd *exec.Cmd
+		var out []byte
+		var err error
+		//
+		if export {
+			if snapshot != nil {
+				snapshot.Close()
+			}
+			if snapshot, err = db.ExportSnapshot(ctx, db.DBName); err != nil {
+				// The error carries what psql wrote on stderr.
+				return []byte(err.Error()), err
+			}
+			db.SnapshotID = snapshot.ID
 		}
-	}
-	//
-	if out, err = cmd.CombinedOutput(); err != nil {
+		dst, cmd = db.PSQL.Backup(ctx, db.DBName, format)
+		//
+		// Before running cmd we have to remove anything currently existing at dst.
+		if _, err = os.Stat(dst); err == nil {
+			if err = db.remove(dst); err != nil {
+				return nil, err
+			}
+		}
+		//
+		out, err = db.run(cmd)
 		db.LogOutput(out)
-		return dst, err
+		return out, err
+	})
+	if err != nil {
+		if snapshot != nil {
+			snapshot.Close()
+		}
+		// An interrupted or timed out backup leaves an incomplete dump behind; its removal is
+		// part of the error so it is logged and reported with the failure.
+		if ctx.Err() != nil && dst != "" {
+			if removeErr := os.RemoveAll(dst); removeErr != nil {
+				err = fmt.Errorf("%w; removing incomplete backup %v: %v", err, dst, removeErr)
+			} else {
+				err = fmt.Errorf("%w; incomplete backup %v removed", err, dst)
+			}
+		}
+		return dst, nil, err
 	}
-	db.LogOutput(out)
 	//
 	// If format is Script then compute a hash as well.
-	if format == Script {
+	if format == Script && !db.DryRun {
 		if err = pgbackup.File(dst).SHA512(); err != nil {
 			db.Warningf("While hashing %v: %v", dst, err)
 		}
 	}
 	//
-	return dst, nil
+	return dst, snapshot, nil
 }
 
 // Chunk splits the given backup.sql file into chunks of the given size in bytes.
@@ -67,6 +121,14 @@ func (db DB) Chunk(src string, size int) error {
 	srcHash := basename + ".sha512"
 	dstHash := filepath.Join(dir, "hash."+filepath.Base(srcHash))
 	//
+	if db.DryRun {
+		db.Infof("rm -rf %v", dir)
+		db.Infof("split %v into %v.* parts of %v bytes", src, dst, size)
+		db.Infof("rm -rf %v", src)
+		db.Infof("mv %v %v", srcHash, dstHash)
+		return nil
+	}
+	//
 	if err = os.RemoveAll(dir); err != nil {
 		return err
 	} else if err = os.MkdirAll(dir, 0777); err != nil {
@@ -100,6 +162,11 @@ func (db DB) Join(src string) error {
 	}
 	sort.Strings(globs)
 	//
+	if db.DryRun {
+		db.Infof("join %v parts from %v into %v", len(globs), src, dst)
+		return nil
+	}
+	//
 	if dfd, err = os.Create(dst); err != nil {
 		return err
 	}
@@ -138,52 +205,474 @@ func (db DB) Join(src string) error {
 
 // Restore performs a restore of DB.
 func (db DB) Restore(ctx context.Context, format Format) error {
+	_, err := db.Retry.Do(ctx, "Restore of "+db.target(), func() ([]byte, error) {
+		if out, err := db.restore(ctx, format, db.target(), false); err != nil {
+			return out, err
+		} else if db.Check != nil {
+			return nil, db.Check(ctx, db.target())
+		}
+		return nil, nil
+	})
+	return err
+}
+
+// SafeRestore performs a restore of DB into a scratch database and replaces the target with it
+// only once the restore has succeeded.  The replaced database is kept under a dated name, which
+// is returned, until it is explicitly dropped; the name is empty if the target did not exist.
+func (db DB) SafeRestore(ctx context.Context, format Format) (string, error) {
+	var retired string
+	target := db.target()
+	scratch := Suffixed(target, "_restoring")
+	//
+	// A failed restore drops scratch so it must not be a database of its own.
+	if exists, err := db.Exists(ctx, scratch); err != nil {
+		return "", err
+	} else if exists {
+		return "", fmt.Errorf("%v already exists; drop it if an earlier restore left it behind", scratch)
+	}
+	//
+	_, err := db.Retry.Do(ctx, "Restore of "+target, func() ([]byte, error) {
+		var exists bool
+		var out []byte
+		var err error
+		//
+		retired = ""
+		if out, err = db.restore(ctx, format, scratch, true); err != nil {
+			db.Cleanup(scratch)
+			return out, err
+		} else if db.Check != nil {
+			if err = db.Check(ctx, scratch); err != nil {
+				db.Cleanup(scratch)
+				return nil, err
+			}
+		}
+		//
+		if exists, err = db.Exists(ctx, target); err != nil {
+			return nil, err
+		} else if exists || db.DryRun {
+			retired = Suffixed(target, "_"+time.Now().Format("20060102_150405"))
+			if db.Terminate {
+				if err = db.disconnect(ctx, target); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if out, err = db.run(db.Swap(ctx, scratch, target, retired)); err != nil {
+			db.LogOutput(out)
+			if retired != "" && db.Terminate {
+				db.allow(target)
+			}
+			retired = ""
+			return out, fmt.Errorf("restored into %v but could not replace %v: %w", scratch, target, err)
+		}
+		db.LogOutput(out)
+		if retired != "" && db.Terminate {
+			db.allow(retired)
+		}
+		return nil, nil
+	})
+	return retired, err
+}
+
+// Exists returns true if the database dbname exists.
+func (db DB) Exists(ctx context.Context, dbname string) (bool, error) {
+	out, err := db.query(ctx, "select 1 from pg_database where datname = "+QuoteLiteral(dbname))
+	if err != nil {
+		return false, err
+	}
+	return out == "1", nil
+}
+
+// restore makes a single attempt at restoring DB into dbname and returns the output of the command
+// that failed.  When strict is true any error reported while restoring from a script is a failure.
+func (db DB) restore(ctx context.Context, format Format, dbname string, strict bool) ([]byte, error) {
 	var cmd *exec.Cmd
 	var out []byte
 	var err error
 	//
-	cmd = db.Drop(ctx, db.DBName)
-	if out, err = cmd.CombinedOutput(); err != nil {
-		db.Warningf("While dropping %v; database may not exist.", db.DBName)
+	if db.ListFile != "" && format == Directory {
+		if err = db.CheckList(ctx, db.ListFile); err != nil {
+			return nil, err
+		}
+	}
+	if db.Filter.IsZero() && db.Content != DataOnly {
+		if out, err = db.dropDatabase(ctx, dbname); err != nil {
+			return out, err
+		}
+		//
+		cmd = db.Create(ctx, dbname)
+		if out, err = db.run(cmd); err != nil {
+			db.LogOutput(out)
+			return out, err
+		}
+		db.LogOutput(out)
+	} else if exists, err := db.Exists(ctx, dbname); err != nil {
+		return nil, err
+	} else if !exists && !db.DryRun {
+		return nil, fmt.Errorf("%v does not exist; a selective or data-only restore requires an existing database", dbname)
 	}
-	db.LogOutput(out)
 	//
-	cmd = db.Create(ctx, db.DBName)
-	if out, err = cmd.CombinedOutput(); err != nil {
+	if format == Script {
+		return db.restoreScript(ctx, dbname, strict)
+	}
+	//
+	if !db.Filter.IsZero() {
+		var list string
+		if list, err = db.filteredList(ctx); err != nil {
+			return nil, err
+		}
+		defer os.Remove(list)
+		db.ListFile = list
+	}
+	cmd = db.PSQL.Restore(ctx, db.DBName, dbname, format)
+	if out, err = db.run(cmd); err != nil {
 		db.LogOutput(out)
-		return err
+		return out, err
 	}
 	db.LogOutput(out)
 	//
-	cmd = db.PSQL.Restore(ctx, db.DBName, format)
-	if format == Script {
-		var stderr io.ReadCloser
-		// Restore from script can become very verbose; limit logging to just stderr.
-		if stderr, err = cmd.StderrPipe(); err != nil {
-			return err
+	if db.MapsRoles() && db.Content != DataOnly {
+		return db.restoreRoles(ctx, db.SchemaScript(ctx, db.DBName), dbname, strict)
+	}
+	return nil, nil
+}
+
+// restoreRoles applies the owners and privileges in the schema script written by the command src
+// to dbname with their roles mapped; the script is streamed through the mapping into psql.
+func (db DB) restoreRoles(ctx context.Context, src *exec.Cmd, dbname string, strict bool) ([]byte, error) {
+	cmd := db.RestoreStream(ctx, dbname)
+	if db.DryRun {
+		return nil, nil
+	}
+	//
+	var stderr bytes.Buffer
+	src.Stderr = &stderr
+	stdout, err := src.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = src.Start(); err != nil {
+		return nil, err
+	}
+	keep := func(item *script.Item) bool {
+		if item.IsSetting() {
+			return true
+		} else if !item.IsOwner() && !item.IsPrivilege() {
+			return false
 		}
+		return db.mapRoles(item)
+	}
+	out, err := db.stream(cmd, dbname, stdout, keep, strict)
+	// If psql stopped early the rest is drained so src is not blocked writing to a full pipe.
+	io.Copy(ioutil.Discard, stdout)
+	if waitErr := src.Wait(); waitErr != nil && err == nil {
+		return stderr.Bytes(), waitErr
+	}
+	return out, err
+}
+
+// restoreScript restores the SQL script of DB into dbname.  When the script has to be filtered or
+// masked it is streamed through keep into psql; otherwise psql reads the file itself.
+func (db DB) restoreScript(ctx context.Context, dbname string, strict bool) ([]byte, error) {
+	var cmd *exec.Cmd
+	var err error
+	//
+	keep, masker := db.keep()
+	if keep == nil {
+		cmd = db.PSQL.Restore(ctx, db.DBName, dbname, Script)
+	} else {
+		cmd = db.RestoreStream(ctx, dbname)
+	}
+	if db.DryRun {
+		return nil, nil
+	}
+	//
+	var src io.ReadCloser
+	if keep != nil {
+		if src, err = db.OpenScript(); err != nil {
+			return nil, err
+		}
+		defer src.Close()
+	}
+	out, err := db.stream(cmd, dbname, src, keep, strict)
+	if err == nil && masker != nil && masker.Err() != nil {
+		// Rows that could not be masked were dropped rather than restored.
+		return nil, masker.Err()
+	}
+	return out, err
+}
+
+// stream runs the psql command cmd restoring into dbname; if keep is not nil the script read from
+// src is passed through keep into the command.
+func (db DB) stream(cmd *exec.Cmd, dbname string, src io.Reader, keep func(item *script.Item) bool, strict bool) ([]byte, error) {
+	var err error
+	//
+	if keep != nil {
+		pr, pw := io.Pipe()
+		defer pr.Close()
 		go func() {
-			defer stderr.Close()
-			log := logger.WarnWriter{Logger: db.PSQL.Logger}
-			if _, err := io.Copy(log, stderr); err != nil {
-				db.Warningf("Piping stderr %v", err)
-			}
+			pw.CloseWithError(script.Transform(pw, src, keep))
 		}()
-		if err = cmd.Run(); err != nil {
-			db.LogOutput(out)
-			return err
+		cmd.Stdin = pr
+	}
+	//
+	// Restore from script can become very verbose; limit logging to just stderr.  A copy of
+	// stderr is kept so failures can be classified for retry.
+	var stderr bytes.Buffer
+	cmd.Stderr = io.MultiWriter(logger.WarnWriter{Logger: db.PSQL.Logger}, &stderr)
+	if err = cmd.Run(); err != nil {
+		return stderr.Bytes(), err
+	}
+	// psql carries on past errors in a script so they have to be counted.
+	if n := bytes.Count(stderr.Bytes(), []byte("ERROR:")); strict && n > 0 {
+		return stderr.Bytes(), fmt.Errorf("%v errors while restoring into %v", n, dbname)
+	}
+	return nil, nil
+}
+
+// keep returns the function that decides which items of a SQL script are restored and the Masker
+// it masks their data with, if any; it returns nil if the whole script is restored unchanged.
+func (db DB) keep() (func(item *script.Item) bool, *script.Masker) {
+	var masker *script.Masker
+	if len(db.Masks) > 0 {
+		masker = db.Masks.NewMasker()
+	}
+	if db.Filter.IsZero() && !db.NoOwner && !db.NoPrivileges && len(db.Roles) == 0 && masker == nil {
+		return nil, nil
+	}
+	return func(item *script.Item) bool {
+		if !db.Filter.IsZero() && !db.Filter.Keep(item) {
+			return false
+		} else if masker != nil && !masker.Keep(item) {
+			return false
 		}
-	} else {
-		if out, err = cmd.CombinedOutput(); err != nil {
-			db.LogOutput(out)
-			return err
+		return db.mapRoles(item)
+	}, masker
+}
+
+// mapRoles drops owners and privileges from the script item as configured and maps the roles in
+// those that remain; it returns false if the item is dropped.
+func (db DB) mapRoles(item *script.Item) bool {
+	if db.NoOwner && item.IsOwner() || db.NoPrivileges && item.IsPrivilege() {
+		return false
+	} else if len(db.Roles) > 0 && item.Kind == script.Statement {
+		item.Text = script.MapRoles(item.Text, db.Roles)
+	}
+	return true
+}
+
+// filteredList writes the entries of the archive of DB selected by Filter to a temporary list
+// file for pg_restore -L and returns its path.
+func (db DB) filteredList(ctx context.Context) (string, error) {
+	if db.DryRun {
+		db.List(ctx, db.DBName)
+		return filepath.Join(os.TempDir(), "pgbackup-"+db.DBName+".list"), nil
+	}
+	toc, err := db.toc(ctx)
+	if err != nil {
+		return "", err
+	}
+	//
+	fd, err := ioutil.TempFile("", "pgbackup-*.list")
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	for _, entry := range toc {
+		if !db.Filter.Match(entry.Schema, entry.Type, entry.Name) {
+			continue
+		} else if _, err = fmt.Fprintln(fd, entry.Line); err != nil {
+			os.Remove(fd.Name())
+			return "", err
 		}
-		db.LogOutput(out)
+	}
+	if err = fd.Close(); err != nil {
+		os.Remove(fd.Name())
+		return "", err
+	}
+	return fd.Name(), nil
+}
+
+// CheckList checks that every entry of the list file given to pg_restore -L is in the archive of
+// DB with the same dump ID, type, schema, and name.
+func (db DB) CheckList(ctx context.Context, path string) error {
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	list, err := ParseTOC(fd)
+	if err != nil {
+		return err
+	} else if len(list) == 0 {
+		return fmt.Errorf("%v has no entries", path)
+	} else if db.DryRun {
+		db.List(ctx, db.DBName)
+		return nil
+	}
+	toc, err := db.toc(ctx)
+	if err != nil {
+		return err
 	}
 	//
+	entries := make(map[int]Entry, len(toc))
+	for _, entry := range toc {
+		entries[entry.ID] = entry
+	}
+	for _, entry := range list {
+		have, ok := entries[entry.ID]
+		if !ok {
+			return fmt.Errorf("%v: entry %v is not in the backup of %v", path, entry.ID, db.DBName)
+		} else if have.Type != entry.Type || have.Schema != entry.Schema || have.Name != entry.Name {
+			return fmt.Errorf("%v: entry %v is %v %v but the backup of %v has %v %v", path, entry.ID,
+				entry.Type, entry.Name, db.DBName, have.Type, have.Name)
+		}
+	}
 	return nil
 }
 
+// toc returns the table of contents of the archive of DB.
+func (db DB) toc(ctx context.Context) (TOC, error) {
+	cmd := db.List(ctx, db.DBName)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		db.LogOutput(stderr.Bytes())
+		return nil, err
+	}
+	return ParseTOC(bytes.NewReader(out))
+}
+
+// dropDatabase drops dbname if it exists.  When Terminate is set connected sessions are terminated
+// first and reported; if the drop still fails connections are allowed again.
+func (db DB) dropDatabase(ctx context.Context, dbname string) ([]byte, error) {
+	var version int
+	var out []byte
+	var err error
+	//
+	if exists, err := db.Exists(ctx, dbname); err != nil {
+		return nil, err
+	} else if !exists && !db.DryRun {
+		return nil, nil
+	}
+	//
+	var cmd *exec.Cmd
+	if db.Terminate {
+		if err = db.disconnect(ctx, dbname); err != nil {
+			return nil, err
+		}
+		if version, err = db.ServerVersion(ctx); err != nil {
+			db.Warningf("While reading server version: %v", err)
+		}
+	}
+	if db.Terminate && version >= 130000 {
+		cmd = db.ForceDrop(ctx, dbname)
+	} else {
+		cmd = db.Drop(ctx, dbname)
+	}
+	out, err = db.run(cmd)
+	db.LogOutput(out)
+	if err != nil {
+		if db.Terminate {
+			db.allow(dbname)
+		}
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return out, fmt.Errorf("dropping %v: %w: %v", dbname, err, msg)
+		}
+		return out, fmt.Errorf("dropping %v: %w", dbname, err)
+	}
+	return nil, nil
+}
+
+// disconnect terminates the sessions connected to dbname and reports them to Notices.
+func (db DB) disconnect(ctx context.Context, dbname string) error {
+	sessions, err := db.Disconnect(ctx, dbname)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		db.noticef("Terminated session on %v: %v", dbname, session)
+	}
+	return nil
+}
+
+// allow allows connections to dbname again after a failed drop or swap; it runs even if the
+// context of the restore is done.
+func (db DB) allow(dbname string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if out, err := db.run(db.AllowConnections(ctx, dbname, true)); err != nil {
+		db.LogOutput(out)
+		db.noticef("Connections to %v are still blocked: %v", dbname, err)
+	}
+}
+
+// noticef sends a message to Notices.
+func (db DB) noticef(format string, vals ...interface{}) {
+	if db.Notices != nil {
+		db.Notices.Infof(format, vals...)
+	}
+}
+
+// Cleanup drops the scratch database dbname after a failed or finished restore; it runs even if
+// the context of the restore is done.  dbname must be a database the restore created.
+func (db DB) Cleanup(dbname string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if out, err := db.run(db.Drop(ctx, dbname)); err != nil {
+		db.LogOutput(out)
+		db.Warningf("While dropping %v: %v", dbname, err)
+	}
+}
+
+// query runs sql and returns its trimmed output; when DryRun is set sql is not run.
+func (db DB) query(ctx context.Context, sql string) (string, error) {
+	return db.output(db.Query(ctx, sql))
+}
+
+// output runs a query command and returns its trimmed output; in a dry run it returns nothing.
+func (db DB) output(cmd *exec.Cmd) (string, error) {
+	if db.DryRun {
+		return "", nil
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %v", err, msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// target returns the name of the database restored into.
+func (db DB) target() string {
+	if db.Target != "" {
+		return db.Target
+	}
+	return db.DBName
+}
+
+// run runs cmd and returns its combined output; when DryRun is set cmd is not run.
+func (db DB) run(cmd *exec.Cmd) ([]byte, error) {
+	if db.DryRun {
+		return nil, nil
+	}
+	return cmd.CombinedOutput()
+}
+
+// remove removes path and anything it contains; when DryRun is set the removal is only logged.
+func (db DB) remove(path string) error {
+	if db.DryRun {
+		db.Infof("rm -rf %v", path)
+		return nil
+	}
+	return os.RemoveAll(path)
+}
+
 // LogOutput logs the output from a command.
 func (db DB) LogOutput(out []byte) {
 	s := strings.TrimSpace(string(out))
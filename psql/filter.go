@@ -0,0 +1,96 @@
+package psql
+
+import (
+	"strings"
+
+	"pgbackup/script"
+)
+
+// Filter selects the objects restored from a backup.  Table names may be qualified with a
+// schema as in public.users.
+type Filter struct {
+	// Schemas restricts the restore to objects in these schemas.
+	Schemas []string
+	// Tables restricts the restore to these tables, views, and sequences and the data,
+	// defaults, constraints, triggers, comments, and privileges that belong to them.
+	Tables []string
+	// ExcludeTables are never restored, nor is anything that belongs to them.
+	ExcludeTables []string
+}
+
+// IsZero returns true if f selects everything.
+func (f Filter) IsZero() bool {
+	return len(f.Schemas) == 0 && len(f.Tables) == 0 && len(f.ExcludeTables) == 0
+}
+
+// Match returns true if the object with the given schema, type, and name is selected.  The type
+// and name are as pg_dump describes the object in a script header or archive listing.
+func (f Filter) Match(schema, typ, name string) bool {
+	if len(f.Schemas) > 0 && !contains(f.Schemas, schema) {
+		return false
+	}
+	table := TableOf(typ, name)
+	if len(f.Tables) > 0 && (table == "" || !matchTable(f.Tables, schema, table)) {
+		return false
+	}
+	if table != "" && matchTable(f.ExcludeTables, schema, table) {
+		return false
+	}
+	return true
+}
+
+// Keep returns true if the script item is selected.  The preamble of the script, settings, and
+// psql meta-commands are always kept.
+func (f Filter) Keep(item *script.Item) bool {
+	if item.Header.IsZero() || item.Kind == script.Meta || item.IsSetting() {
+		return true
+	}
+	return f.Match(item.Header.Schema, item.Header.Type, item.Header.Name)
+}
+
+// TableOf returns the name of the table, view, or sequence that the object with the given type and
+// name belongs to; it returns an empty string if the object does not belong to one.
+func TableOf(typ, name string) string {
+	switch typ {
+	case "TABLE", "TABLE DATA", "VIEW", "MATERIALIZED VIEW", "MATERIALIZED VIEW DATA",
+		"FOREIGN TABLE", "SEQUENCE", "SEQUENCE SET", "SEQUENCE OWNED BY":
+		return name
+	case "DEFAULT", "CONSTRAINT", "CHECK CONSTRAINT", "FK CONSTRAINT", "TRIGGER", "POLICY", "RULE", "ROW SECURITY":
+		// Named "table object".
+		return strings.SplitN(name, " ", 2)[0]
+	case "ACL", "COMMENT", "SECURITY LABEL":
+		// Named "TABLE table" or "COLUMN table.column".
+		for _, prefix := range []string{"TABLE ", "VIEW ", "MATERIALIZED VIEW ", "FOREIGN TABLE ", "SEQUENCE "} {
+			if strings.HasPrefix(name, prefix) {
+				return strings.TrimPrefix(name, prefix)
+			}
+		}
+		if strings.HasPrefix(name, "COLUMN ") {
+			column := strings.TrimPrefix(name, "COLUMN ")
+			if k := strings.LastIndex(column, "."); k >= 0 {
+				return column[:k]
+			}
+		}
+	}
+	return ""
+}
+
+// matchTable returns true if table in schema is in names.
+func matchTable(names []string, schema, table string) bool {
+	for _, name := range names {
+		if name == table || name == schema+"."+table {
+			return true
+		}
+	}
+	return false
+}
+
+// contains returns true if s is in list.
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
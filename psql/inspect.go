@@ -0,0 +1,167 @@
+package psql
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"pgbackup/script"
+)
+
+// Inspect returns the table of contents of the backup of DB without restoring it.
+//
+// Directory backups are listed with pg_restore -l and the size of each data entry is the size of
+// its data file.  Script backups are scanned for the sections that create objects or hold data and
+// the size of each entry is the size of its section of the script.
+func (db DB) Inspect(ctx context.Context, format Format) (TOC, error) {
+	if format == Script {
+		rc, err := db.OpenScript()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return InspectScript(rc)
+	}
+	//
+	// Data files are named for the dump ID with an extension for the compression.
+	dir := filepath.Join(db.DirBackups, db.Content.Name(db.DBName)+".backup")
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	toc, err := db.toc(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sizes := map[int]int64{}
+	for _, info := range infos {
+		name := info.Name()
+		if k := strings.Index(name, ".dat"); k > 0 {
+			if id, err := strconv.Atoi(name[:k]); err == nil {
+				sizes[id] = info.Size()
+			}
+		}
+	}
+	for k := range toc {
+		toc[k].Size = sizes[toc[k].ID]
+	}
+	return toc, nil
+}
+
+// InspectScript returns the table of contents of a SQL script; entries are numbered in the order
+// they appear.  Only sections that create objects or hold data are included.
+func InspectScript(r io.Reader) (TOC, error) {
+	var rv TOC
+	var entry *Entry
+	var creates bool
+	// add appends the current entry if it creates an object or holds data.
+	add := func() {
+		if entry != nil && (creates || entry.Size > 0 && script.IsData(entry.Type)) {
+			entry.ID = len(rv) + 1
+			rv = append(rv, *entry)
+		}
+	}
+	//
+	rd := script.NewReader(r)
+	for {
+		item, err := rd.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if item.Header.IsZero() {
+			continue
+		} else if entry == nil || item.Header != (script.Header{Name: entry.Name, Type: entry.Type, Schema: entry.Schema, Owner: entry.Owner}) {
+			add()
+			entry = &Entry{
+				Type:   item.Header.Type,
+				Schema: item.Header.Schema,
+				Name:   item.Header.Name,
+				Owner:  item.Header.Owner,
+			}
+			creates = false
+		}
+		switch item.Kind {
+		case script.Statement:
+			if text := strings.TrimSpace(item.Text); len(text) > 7 && strings.EqualFold(text[:7], "CREATE ") {
+				creates = true
+			}
+			if script.IsData(entry.Type) && !item.IsSetting() && !item.IsCopy() {
+				entry.Size += int64(len(item.Text))
+			}
+		case script.CopyData:
+			if strings.TrimRight(item.Text, "\r\n") != `\.` {
+				entry.Size += int64(len(item.Text))
+			}
+		}
+	}
+	add()
+	return rv, nil
+}
+
+// OpenScript opens the SQL script backup of DB; if the script was split with Chunk its parts are
+// read in order.
+func (db DB) OpenScript() (io.ReadCloser, error) {
+	name := db.Content.Name(db.DBName)
+	fd, err := os.Open(filepath.Join(db.DirBackups, name+".sql"))
+	if err == nil || !os.IsNotExist(err) {
+		return fd, err
+	}
+	dir := filepath.Join(db.DirBackups, name+".chunk")
+	parts, globErr := filepath.Glob(filepath.Join(dir, name+".*"))
+	if globErr != nil {
+		return nil, globErr
+	} else if len(parts) == 0 {
+		return nil, err
+	}
+	sort.Strings(parts)
+	return &multiFile{parts: parts}, nil
+}
+
+// multiFile reads a sequence of files as one stream, opening each file only when it is reached.
+type multiFile struct {
+	parts []string
+	fd    *os.File
+}
+
+// Read reads from the current part and moves to the next part at the end of each one.
+func (m *multiFile) Read(p []byte) (int, error) {
+	for {
+		if m.fd == nil {
+			if len(m.parts) == 0 {
+				return 0, io.EOF
+			}
+			fd, err := os.Open(m.parts[0])
+			if err != nil {
+				return 0, err
+			}
+			m.fd, m.parts = fd, m.parts[1:]
+		}
+		n, err := m.fd.Read(p)
+		if err == io.EOF {
+			m.fd.Close()
+			m.fd = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// Close closes the current part.
+func (m *multiFile) Close() error {
+	if m.fd != nil {
+		err := m.fd.Close()
+		m.fd = nil
+		return err
+	}
+	return nil
+}
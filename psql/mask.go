@@ -0,0 +1,53 @@
+package psql
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"pgbackup"
+	"pgbackup/script"
+)
+
+// Mask writes a copy of the SQL script backup of DB with its data masked by Masks beside the
+// backup and returns its path; the copy is named with MaskedSuffix and hashed like the backup.
+// A backup split with Chunk is read from its parts.
+func (db DB) Mask() (string, error) {
+	var err error
+	//
+	// The copy is named as the backup of a database named with MaskedSuffix so it is restored
+	// like one.
+	name := db.Content.Name(db.DBName)
+	dst := filepath.Join(db.DirBackups, db.Content.Name(db.DBName+MaskedSuffix)+".sql")
+	if db.DryRun {
+		db.Infof("mask %v into %v", filepath.Join(db.DirBackups, name+".sql"), dst)
+		return dst, nil
+	}
+	//
+	src, err := db.OpenScript()
+	if err != nil {
+		return dst, err
+	}
+	defer src.Close()
+	//
+	// Written to a temporary file first so a failed mask never leaves a partly masked copy.
+	tmp := dst + ".tmp"
+	fd, err := os.Create(tmp)
+	if err != nil {
+		return dst, err
+	}
+	defer os.Remove(tmp)
+	defer fd.Close()
+	//
+	masker := db.Masks.NewMasker()
+	if err = script.Transform(fd, src, masker.Keep); err != nil {
+		return dst, err
+	} else if err = masker.Err(); err != nil {
+		return dst, fmt.Errorf("masking %v: %w", name, err)
+	} else if err = fd.Close(); err != nil {
+		return dst, err
+	} else if err = os.Rename(tmp, dst); err != nil {
+		return dst, err
+	}
+	return dst, pgbackup.File(dst).SHA512()
+}
@@ -0,0 +1,180 @@
+package psql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Meta is the metadata recorded beside a backup in dbname.meta.json.
+type Meta struct {
+	Database string `json:"database"`
+	Format   string `json:"format"`
+	// Content is what the backup holds when it is not the full database.
+	Content string `json:"content,omitempty"`
+	// DataStyle and RowsPerInsert are how the data of SQL script backups is written.
+	DataStyle     string    `json:"data_style,omitempty"`
+	RowsPerInsert int       `json:"rows_per_insert,omitempty"`
+	Created       time.Time `json:"created"`
+	Server        Server    `json:"server"`
+	Counts
+}
+
+// Counts are the numbers of objects and table rows in a database.
+type Counts struct {
+	// Objects is the number of objects of each kind outside the system schemas.
+	Objects map[string]int64 `json:"objects,omitempty"`
+	// Rows is the number of rows in each table by qualified name.
+	Rows map[string]int64 `json:"rows,omitempty"`
+}
+
+// Compare compares have against c and returns a message for each count that differs from c by
+// more than tolerance percent; counts in have that are missing from c are ignored.
+func (c Counts) Compare(have Counts, tolerance float64) []string {
+	var rv []string
+	// differs returns true if n is outside the tolerance around want.
+	differs := func(want, n int64) bool {
+		diff := float64(want - n)
+		if diff < 0 {
+			diff = -diff
+		}
+		return diff > float64(want)*tolerance/100
+	}
+	for _, kind := range sortedKeys(c.Objects) {
+		if want, n := c.Objects[kind], have.Objects[kind]; differs(want, n) {
+			rv = append(rv, fmt.Sprintf("%v %v in backup; %v restored", want, kind, n))
+		}
+	}
+	for _, table := range sortedKeys(c.Rows) {
+		if want, n := c.Rows[table], have.Rows[table]; differs(want, n) {
+			rv = append(rv, fmt.Sprintf("%v has %v rows in backup; %v restored", table, want, n))
+		}
+	}
+	return rv
+}
+
+// MetaPath returns the path of the metadata of the backup of dbname.
+func (p PSQL) MetaPath(dbname string) string {
+	return filepath.Join(p.DirBackups, p.Content.Name(dbname)+".meta.json")
+}
+
+// ReadMeta reads the metadata recorded with the backup of DB.
+func (db DB) ReadMeta() (Meta, error) {
+	var rv Meta
+	buf, err := ioutil.ReadFile(db.MetaPath(db.DBName))
+	if err != nil {
+		return rv, err
+	}
+	if err = json.Unmarshal(buf, &rv); err != nil {
+		return rv, fmt.Errorf("%v: %w", db.MetaPath(db.DBName), err)
+	}
+	return rv, nil
+}
+
+// WriteMeta writes the metadata for the backup of DB.
+func (db DB) WriteMeta(meta Meta) error {
+	path := db.MetaPath(db.DBName)
+	if db.DryRun {
+		db.Infof("write %v", path)
+		return nil
+	}
+	buf, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Written to a temporary file first so a failed write never leaves a truncated file.
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, append(buf, '\n'), 0660); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// userSchemas is the condition on pg_namespace n that excludes the system schemas.
+const userSchemas = `n.nspname not in ('pg_catalog', 'information_schema') and n.nspname !~ '^pg_(toast|temp)'`
+
+// Counts returns the number of objects in dbname; when rows is true the rows in every table are
+// counted as well, which reads every table in full.
+func (db DB) Counts(ctx context.Context, dbname string, rows bool) (Counts, error) {
+	var rv Counts
+	var err error
+	//
+	objects := `select kind, count(*) from (
+select case c.relkind
+	when 'r' then 'tables' when 'p' then 'tables' when 'f' then 'foreign tables'
+	when 'v' then 'views' when 'm' then 'materialized views'
+	when 'S' then 'sequences' when 'i' then 'indexes' when 'I' then 'indexes' end as kind
+	from pg_class c join pg_namespace n on n.oid = c.relnamespace where ` + userSchemas + `
+union all select 'functions' from pg_proc p join pg_namespace n on n.oid = p.pronamespace where ` + userSchemas + `
+union all select 'schemas' from pg_namespace n where ` + userSchemas + `
+) o where kind is not null group by kind`
+	if rv.Objects, err = db.counts(ctx, dbname, objects); err != nil || !rows {
+		return rv, err
+	}
+	// Tables that belong to extensions are created and filled by the extension.
+	tables := `select n.nspname || '.' || c.relname,
+	(xpath('/row/c/text()', query_to_xml(format('select count(*) as c from %I.%I', n.nspname, c.relname), false, true, '')))[1]::text
+	from pg_class c join pg_namespace n on n.oid = c.relnamespace
+	where c.relkind = 'r' and ` + userSchemas + `
+	and not exists (select 1 from pg_depend d where d.classid = 'pg_class'::regclass and d.objid = c.oid and d.deptype = 'e')`
+	rv.Rows, err = db.counts(ctx, dbname, tables)
+	return rv, err
+}
+
+// Analyze runs ANALYZE in dbname to rebuild the planner statistics; when vacuum is true it runs
+// VACUUM ANALYZE instead.
+func (db DB) Analyze(ctx context.Context, dbname string, vacuum bool) error {
+	sql := "analyze"
+	if vacuum {
+		sql = "vacuum analyze"
+	}
+	_, err := db.output(db.QueryDB(ctx, dbname, sql))
+	return err
+}
+
+// counts runs a query in dbname, or in Snapshot if it is not nil, that returns a name and a count
+// on each line.
+func (db DB) counts(ctx context.Context, dbname string, sql string) (map[string]int64, error) {
+	var out string
+	var err error
+	//
+	if db.Snapshot != nil {
+		out, err = db.Snapshot.Query(sql)
+	} else {
+		out, err = db.output(db.QueryDB(ctx, dbname, sql))
+	}
+	if err != nil {
+		return nil, err
+	}
+	rv := map[string]int64{}
+	for _, line := range strings.Split(out, "\n") {
+		k := strings.LastIndex(line, "|")
+		if k < 0 {
+			continue
+		}
+		n, err := strconv.ParseInt(line[k+1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected count %q: %w", line, err)
+		}
+		rv[line[:k]] = n
+	}
+	return rv, nil
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys(m map[string]int64) []string {
+	rv := make([]string, 0, len(m))
+	for key := range m {
+		rv = append(rv, key)
+	}
+	sort.Strings(rv)
+	return rv
+}
@@ -3,11 +3,15 @@ package psql
 import (
 	"context"
 	"fmt"
+	"hash/fnv"
+	"net/url"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"unicode/utf8"
 
 	"pgbackup/logger"
+	"pgbackup/script"
 )
 
 // Format specifies backup format.
@@ -20,6 +24,91 @@ const (
 	Script
 )
 
+// String returns the name of the format.
+func (f Format) String() string {
+	switch f {
+	case Directory:
+		return "directory"
+	case Script:
+		return "script"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// Content is what a backup holds.
+type Content int
+
+const (
+	// Backups hold the schema and the data and are named for the database.
+	Full Content = iota
+	// Backups hold only the schema and are named dbname.schema.
+	SchemaOnly
+	// Backups hold only the data and are named dbname.data.
+	DataOnly
+)
+
+// String returns the name of the content.
+func (c Content) String() string {
+	switch c {
+	case Full:
+		return "full"
+	case SchemaOnly:
+		return "schema"
+	case DataOnly:
+		return "data"
+	}
+	return fmt.Sprintf("Content(%d)", int(c))
+}
+
+// Name returns the name of the backup of dbname holding c; the extension for the format is
+// added to it.
+func (c Content) Name(dbname string) string {
+	if c == Full {
+		return dbname
+	}
+	return dbname + "." + c.String()
+}
+
+// MaskedSuffix is added to the name of a backup to name the masked copy written beside it.
+const MaskedSuffix = ".masked"
+
+// ParseName returns the database and content of the backup with the given name, the converse of
+// Content.Name.
+func ParseName(name string) (string, Content) {
+	for _, c := range []Content{SchemaOnly, DataOnly} {
+		if strings.HasSuffix(name, "."+c.String()) {
+			return strings.TrimSuffix(name, "."+c.String()), c
+		}
+	}
+	return name, Full
+}
+
+// DataStyle is how table data is written to SQL script backups.
+type DataStyle int
+
+const (
+	// Data is written as INSERT statements that name their columns.
+	ColumnInserts DataStyle = iota
+	// Data is written as COPY statements followed by their rows; it is the smallest and fastest
+	// to restore.
+	Copy
+	// Data is written as INSERT statements without column names.
+	Inserts
+)
+
+// String returns the name of the data style.
+func (d DataStyle) String() string {
+	switch d {
+	case ColumnInserts:
+		return "column-inserts"
+	case Copy:
+		return "copy"
+	case Inserts:
+		return "inserts"
+	}
+	return fmt.Sprintf("DataStyle(%d)", int(d))
+}
+
 // PSQL is the wrapper to psql, pg_dump, and pg_restore.
 type PSQL struct {
 	// Directory where backups are stored.
@@ -27,6 +116,55 @@ type PSQL struct {
 	// For backup or restore operations that can run concurrently this specifies the
 	// -j argument to pg_dump and pg_restore.
 	Jobs int
+	// Conn is a connection string or URI for the server such as "host=db1 port=5432 user=app";
+	// each database name is combined with it.  If empty the defaults and PG* environment variables
+	// of libpq are used.  Passwords belong in a password file rather than in Conn as commands are
+	// logged.
+	Conn string
+	// Binaries maps psql, pg_dump, and pg_restore to the paths of the binaries run for them; tools
+	// that are not mapped are found on PATH.
+	Binaries map[string]string
+	// Content is what backups hold; it is also part of their names.
+	Content Content
+	// Compression is passed to pg_dump -Z for directory backups; if empty the pg_dump default is
+	// used.  SQL script backups are never compressed.
+	Compression string
+	// DataStyle is how table data is written to SQL script backups.
+	DataStyle DataStyle
+	// RowsPerInsert is the number of rows in each INSERT statement of SQL script backups when
+	// DataStyle writes INSERT statements; 0 or 1 writes one row per statement.
+	RowsPerInsert int
+	// Args are extra arguments for each tool; they are added to the commands that back up,
+	// dump, and restore databases but not to queries.
+	Args map[string][]string
+	// Retry is the policy for retrying failed backups and restores.
+	Retry Retry
+	// When DryRun is true commands are logged but never run and no files are changed.
+	DryRun bool
+	// When Terminate is true databases are dropped even if sessions are connected to them.
+	Terminate bool
+	// Filter selects the objects restored; if it is not the zero Filter restores go into an
+	// existing database without dropping it.
+	Filter Filter
+	// ListFile is a list file passed to pg_restore -L to select the archive entries restored; it is
+	// checked against the archive before the database is dropped.
+	ListFile string
+	// NoOwner restores objects owned by the restoring user instead of their original owners.
+	NoOwner bool
+	// NoPrivileges restores objects without their grants and revokes.
+	NoPrivileges bool
+	// Roles maps the roles named in a backup to the roles used in its place on restore.
+	Roles map[string]string
+	// Masks are the rules masking the data restored from SQL script backups; if empty data is
+	// restored as it is.
+	Masks script.Masks
+	// SnapshotID is a snapshot exported by another session that backups are dumped in; if empty
+	// pg_dump takes its own.
+	SnapshotID string
+	//
+	// Notices receives messages that should always be shown, such as the sessions terminated
+	// before a drop, regardless of Logger; if nil they are discarded.
+	Notices logger.Logger
 	//
 	logger.Logger
 }
@@ -36,23 +174,38 @@ type PSQL struct {
 func (p PSQL) Backup(ctx context.Context, dbname string, format Format) (string, *exec.Cmd) {
 	var dest string
 	var args []string
-	binary := "pg_dump"
+	binary := p.Binary("pg_dump")
 	if format == Script {
-		dest = filepath.Join(p.DirBackups, dbname+".sql")
-		args = []string{
-			"--column-inserts",
-			"-d", dbname,
+		dest = filepath.Join(p.DirBackups, p.Content.Name(dbname)+".sql")
+		args = append(p.dataStyle(), []string{
+			"-d", p.dsn(dbname),
 			"-f", dest,
-		}
+		}...)
 	} else {
-		dest = filepath.Join(p.DirBackups, dbname+".backup")
+		dest = filepath.Join(p.DirBackups, p.Content.Name(dbname)+".backup")
 		args = []string{
 			"-Fd",
 			"-j", fmt.Sprintf("%v", p.Jobs),
 			"-f", dest,
-			dbname,
 		}
 	}
+	switch p.Content {
+	case SchemaOnly:
+		args = append(args, "-s")
+	case DataOnly:
+		args = append(args, "-a")
+	}
+	// pg_dump -Z would gzip a SQL script into a file psql cannot read.
+	if p.Compression != "" && format == Directory {
+		args = append(args, "-Z", p.Compression)
+	}
+	args = append(args, p.Args["pg_dump"]...)
+	if format != Script {
+		args = append(args, p.dsn(dbname))
+	}
+	if p.SnapshotID != "" {
+		args = append([]string{"--snapshot=" + p.SnapshotID}, args...)
+	}
 	//
 	p.Infof("%v %v", binary, strings.Join(args, " "))
 	//
@@ -61,11 +214,25 @@ func (p PSQL) Backup(ctx context.Context, dbname string, format Format) (string,
 
 // Create returns the command to execute for creating a database.
 func (p PSQL) Create(ctx context.Context, dbname string) *exec.Cmd {
-	binary := "psql"
-	args := []string{
+	binary := p.Binary("psql")
+	args := append(p.server(),
 		"-c",
-		"create database \"" + dbname + "\"",
-	}
+		"create database "+QuoteIdent(dbname),
+	)
+	//
+	p.Infof("%v %v", binary, strings.Join(args, " "))
+	//
+	return exec.CommandContext(ctx, binary, args...)
+}
+
+// AllowConnections returns the command to execute for allowing or blocking new connections
+// to a database.
+func (p PSQL) AllowConnections(ctx context.Context, dbname string, allow bool) *exec.Cmd {
+	binary := p.Binary("psql")
+	args := append(p.server(),
+		"-c",
+		fmt.Sprintf("alter database %v allow_connections %v", QuoteIdent(dbname), allow),
+	)
 	//
 	p.Infof("%v %v", binary, strings.Join(args, " "))
 	//
@@ -74,10 +241,84 @@ func (p PSQL) Create(ctx context.Context, dbname string) *exec.Cmd {
 
 // Drop returns the command to execute for dropping a database.
 func (p PSQL) Drop(ctx context.Context, dbname string) *exec.Cmd {
-	binary := "psql"
+	return p.drop(ctx, dbname, false)
+}
+
+// ForceDrop returns the command to execute for dropping a database and terminating any sessions
+// connected to it; it requires Postgres 13 or later.
+func (p PSQL) ForceDrop(ctx context.Context, dbname string) *exec.Cmd {
+	return p.drop(ctx, dbname, true)
+}
+
+// drop returns the command to execute for dropping a database.
+func (p PSQL) drop(ctx context.Context, dbname string, force bool) *exec.Cmd {
+	binary := p.Binary("psql")
+	sql := "drop database " + QuoteIdent(dbname)
+	if force {
+		sql = sql + " with (force)"
+	}
+	args := append(p.server(),
+		"-c",
+		sql,
+	)
+	//
+	p.Infof("%v %v", binary, strings.Join(args, " "))
+	//
+	return exec.CommandContext(ctx, binary, args...)
+}
+
+// List returns the command to execute for listing the table of contents of the archive of src.
+func (p PSQL) List(ctx context.Context, src string) *exec.Cmd {
+	binary := p.Binary("pg_restore")
+	args := []string{
+		"-l",
+		filepath.Join(p.DirBackups, p.Content.Name(src)+".backup"),
+	}
+	//
+	p.Infof("%v %v", binary, strings.Join(args, " "))
+	//
+	return exec.CommandContext(ctx, binary, args...)
+}
+
+// Query returns the command to execute for running sql and printing the result rows unaligned
+// and without headers.
+func (p PSQL) Query(ctx context.Context, sql string) *exec.Cmd {
+	binary := p.Binary("psql")
+	args := append(p.server(),
+		"-X", "-t", "-A",
+		"-c",
+		sql,
+	)
+	//
+	p.Infof("%v %v", binary, strings.Join(args, " "))
+	//
+	return exec.CommandContext(ctx, binary, args...)
+}
+
+// QueryDB returns the command to execute for running sql in the database dbname with unaligned
+// output and no headers.
+func (p PSQL) QueryDB(ctx context.Context, dbname string, sql string) *exec.Cmd {
+	binary := p.Binary("psql")
 	args := []string{
+		"-X", "-t", "-A",
+		"-d", p.dsn(dbname),
 		"-c",
-		"drop database \"" + dbname + "\"",
+		sql,
+	}
+	//
+	p.Infof("%v %v", binary, strings.Join(args, " "))
+	//
+	return exec.CommandContext(ctx, binary, args...)
+}
+
+// Session returns the command to execute for a psql session in the database dbname that runs the
+// queries written to its stdin with unaligned output and no headers; it stops at the first error.
+func (p PSQL) Session(ctx context.Context, dbname string) *exec.Cmd {
+	binary := p.Binary("psql")
+	args := []string{
+		"-X", "-t", "-A", "-q",
+		"-v", "ON_ERROR_STOP=1",
+		"-d", p.dsn(dbname),
 	}
 	//
 	p.Infof("%v %v", binary, strings.Join(args, " "))
@@ -85,30 +326,245 @@ func (p PSQL) Drop(ctx context.Context, dbname string) *exec.Cmd {
 	return exec.CommandContext(ctx, binary, args...)
 }
 
-// Restore returns the data source and command to execute for restoring a database.
+// RestoreStream returns the command to execute for restoring a SQL script into the database
+// dbname; the script must be written to the command's stdin.
+func (p PSQL) RestoreStream(ctx context.Context, dbname string) *exec.Cmd {
+	binary := p.Binary("psql")
+	args := []string{
+		"-d", p.dsn(dbname),
+		"-f", "-",
+	}
+	args = append(args, p.Args["psql"]...)
+	//
+	p.Infof("%v %v", binary, strings.Join(args, " "))
+	//
+	return exec.CommandContext(ctx, binary, args...)
+}
+
+// Swap returns the command to execute for replacing the database dbname with the database
+// scratch.  Sessions connected to dbname are terminated and it is renamed to retired before
+// scratch is renamed to dbname; if retired is empty dbname is assumed not to exist.
 //
-// Note that when format is Script the src needs to be piped into the commands StdinPipe
-// during execution.
-func (p PSQL) Restore(ctx context.Context, dbname string, format Format) *exec.Cmd {
+// The statements run in a single transaction so either both renames happen or neither does.
+func (p PSQL) Swap(ctx context.Context, scratch string, dbname string, retired string) *exec.Cmd {
+	binary := p.Binary("psql")
+	var sql []string
+	if retired != "" {
+		sql = append(sql,
+			"select pg_terminate_backend(pid) from pg_stat_activity where datname = "+QuoteLiteral(dbname)+" and pid <> pg_backend_pid()",
+			"alter database "+QuoteIdent(dbname)+" rename to "+QuoteIdent(retired),
+		)
+	}
+	sql = append(sql, "alter database "+QuoteIdent(scratch)+" rename to "+QuoteIdent(dbname))
+	args := append(p.server(),
+		"-c",
+		strings.Join(sql, "; "),
+	)
+	//
+	p.Infof("%v %v", binary, strings.Join(args, " "))
+	//
+	return exec.CommandContext(ctx, binary, args...)
+}
+
+// Restore returns the command to execute for restoring the backup of src into the database dbname.
+func (p PSQL) Restore(ctx context.Context, src string, dbname string, format Format) *exec.Cmd {
 	var binary string
 	var args []string
 	if format == Script {
-		binary = "psql"
+		binary = p.Binary("psql")
 		args = []string{
-			"-d", dbname,
-			"-f", filepath.Join(p.DirBackups, dbname+".sql"),
+			"-d", p.dsn(dbname),
+			"-f", filepath.Join(p.DirBackups, p.Content.Name(src)+".sql"),
 		}
+		args = append(args, p.Args["psql"]...)
 	} else {
-		binary = "pg_restore"
+		binary = p.Binary("pg_restore")
 		args = []string{
 			"-Fd",
 			"-j", fmt.Sprintf("%v", p.Jobs),
-			"-d", dbname,
-			filepath.Join(p.DirBackups, dbname+".backup"),
+			"-d", p.dsn(dbname),
+		}
+		args = append(args, p.ownership()...)
+		if p.ListFile != "" {
+			args = append(args, "-L", p.ListFile)
 		}
+		args = append(args, p.Args["pg_restore"]...)
+		args = append(args, filepath.Join(p.DirBackups, p.Content.Name(src)+".backup"))
+	}
+	//
+	p.Infof("%v %v", binary, strings.Join(args, " "))
+	//
+	return exec.CommandContext(ctx, binary, args...)
+}
+
+// SchemaScript returns the command that writes the schema in the directory backup of src to
+// stdout as a SQL script.
+func (p PSQL) SchemaScript(ctx context.Context, src string) *exec.Cmd {
+	binary := p.Binary("pg_restore")
+	args := []string{
+		"-Fd",
+		"-s",
+		"-f", "-",
+	}
+	if p.ListFile != "" {
+		args = append(args, "-L", p.ListFile)
+	}
+	args = append(args, filepath.Join(p.DirBackups, p.Content.Name(src)+".backup"))
+	//
+	p.Infof("%v %v", binary, strings.Join(args, " "))
+	//
+	return exec.CommandContext(ctx, binary, args...)
+}
+
+// ToolVersion returns the command to execute for printing the version of tool, one of psql,
+// pg_dump, or pg_restore.
+func (p PSQL) ToolVersion(ctx context.Context, tool string) *exec.Cmd {
+	binary := p.Binary(tool)
+	args := []string{
+		"--version",
+	}
+	//
+	p.Infof("%v %v", binary, strings.Join(args, " "))
+	//
+	return exec.CommandContext(ctx, binary, args...)
+}
+
+// Dump returns the command to execute for writing the database dbname to stdout as an archive
+// in custom format.
+func (p PSQL) Dump(ctx context.Context, dbname string) *exec.Cmd {
+	binary := p.Binary("pg_dump")
+	args := []string{
+		"-Fc",
+		"-d", p.dsn(dbname),
+	}
+	args = append(args, p.Args["pg_dump"]...)
+	//
+	p.Infof("%v %v", binary, strings.Join(args, " "))
+	//
+	return exec.CommandContext(ctx, binary, args...)
+}
+
+// DumpSchema returns the command to execute for writing the schema of the database dbname to
+// stdout as a SQL script.
+func (p PSQL) DumpSchema(ctx context.Context, dbname string) *exec.Cmd {
+	binary := p.Binary("pg_dump")
+	args := []string{
+		"-s",
+		"-d", p.dsn(dbname),
 	}
 	//
 	p.Infof("%v %v", binary, strings.Join(args, " "))
 	//
 	return exec.CommandContext(ctx, binary, args...)
 }
+
+// RestoreArchive returns the command to execute for restoring an archive in custom format into
+// the database dbname; the archive must be written to the command's stdin.
+func (p PSQL) RestoreArchive(ctx context.Context, dbname string) *exec.Cmd {
+	binary := p.Binary("pg_restore")
+	args := append([]string{
+		"-d", p.dsn(dbname),
+	}, p.ownership()...)
+	args = append(args, p.Args["pg_restore"]...)
+	//
+	p.Infof("%v %v", binary, strings.Join(args, " "))
+	//
+	return exec.CommandContext(ctx, binary, args...)
+}
+
+// dataStyle returns the pg_dump arguments that write data in DataStyle.
+func (p PSQL) dataStyle() []string {
+	var rv []string
+	switch p.DataStyle {
+	case Copy:
+		return nil
+	case Inserts:
+		rv = []string{"--inserts"}
+	default:
+		rv = []string{"--column-inserts"}
+	}
+	if p.RowsPerInsert > 1 {
+		rv = append(rv, "--rows-per-insert", fmt.Sprintf("%v", p.RowsPerInsert))
+	}
+	return rv
+}
+
+// ownership returns the pg_restore arguments that skip owners and privileges; they are also
+// skipped when roles are mapped so they can be applied afterwards.
+func (p PSQL) ownership() []string {
+	var rv []string
+	if p.NoOwner || p.MapsRoles() {
+		rv = append(rv, "-O")
+	}
+	if p.NoPrivileges || p.MapsRoles() {
+		rv = append(rv, "-x")
+	}
+	return rv
+}
+
+// Binary returns the binary run for tool, one of psql, pg_dump, or pg_restore.
+func (p PSQL) Binary(tool string) string {
+	if path, ok := p.Binaries[tool]; ok && path != "" {
+		return path
+	}
+	return tool
+}
+
+// dsn returns the argument for -d that connects to the database dbname on the server of Conn.
+func (p PSQL) dsn(dbname string) string {
+	if p.Conn == "" {
+		return dbname
+	} else if strings.HasPrefix(p.Conn, "postgres://") || strings.HasPrefix(p.Conn, "postgresql://") {
+		if u, err := url.Parse(p.Conn); err == nil {
+			u.Path, u.RawPath = "/"+dbname, ""
+			return u.String()
+		}
+	}
+	// A later keyword in a connection string overrides an earlier one.
+	value := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(dbname)
+	return p.Conn + " dbname='" + value + "'"
+}
+
+// server returns the arguments that connect to the server of Conn for commands that are not run
+// in a particular database.
+func (p PSQL) server() []string {
+	if p.Conn == "" {
+		return nil
+	}
+	return []string{"-d", p.Conn}
+}
+
+// MapsRoles returns true if roles are mapped and there are owners or privileges to map them in.
+func (p PSQL) MapsRoles() bool {
+	return len(p.Roles) > 0 && !(p.NoOwner && p.NoPrivileges)
+}
+
+// MaxIdentLen is the maximum length in bytes of a Postgres identifier.
+const MaxIdentLen = 63
+
+// QuoteIdent quotes s for use as an identifier in SQL.
+func QuoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// QuoteLiteral quotes s for use as a string literal in SQL.
+func QuoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// Suffixed returns name with suffix appended; name is shortened as needed so the result
+// fits in MaxIdentLen bytes.  A shortened name is followed by a hash of the whole name so names
+// that only differ past the cut stay distinct.
+func Suffixed(name string, suffix string) string {
+	if len(name)+len(suffix) <= MaxIdentLen {
+		return name + suffix
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	hash := fmt.Sprintf("_%08x", h.Sum32())
+	for len(name)+len(hash)+len(suffix) > MaxIdentLen && name != "" {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name + hash + suffix
+}
@@ -0,0 +1,149 @@
+package psql
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"os/exec"
+	"time"
+
+	"pgbackup/logger"
+)
+
+// retryable lists fragments of pg_dump, pg_restore, and psql error output that indicate
+// a transient problem with the connection or server rather than a problem with the database.
+// Since PostgreSQL 14 every connection failure starts with "connection to server ... failed",
+// including permanent ones such as failed authentication, so only the causes are matched.
+var retryable = [][]byte{
+	[]byte("could not connect to server"),
+	[]byte("server closed the connection unexpectedly"),
+	[]byte("terminating connection due to administrator command"),
+	[]byte("the database system is starting up"),
+	[]byte("the database system is shutting down"),
+	[]byte("the database system is in recovery mode"),
+	[]byte("sorry, too many clients already"),
+	[]byte("remaining connection slots are reserved"),
+	[]byte("could not receive data from server"),
+	[]byte("could not send data to server"),
+	[]byte("no connection to the server"),
+	[]byte("SSL SYSCALL error"),
+	[]byte("SSL connection has been closed unexpectedly"),
+	[]byte("Connection refused"),
+	[]byte("Connection reset by peer"),
+	[]byte("Connection timed out"),
+	[]byte("timeout expired"),
+	[]byte("could not translate host name"),
+}
+
+// Retry describes how failed backup and restore commands are retried.
+type Retry struct {
+	// Attempts is the maximum number of attempts; values less than 1 mean a single attempt.
+	Attempts int
+	// Delay is the wait before the first retry; it doubles after each failed attempt.
+	Delay time.Duration
+	// MaxDelay caps the wait between attempts; if 0 or less there is no cap.
+	MaxDelay time.Duration
+	//
+	logger.Logger
+}
+
+// Backoff returns the wait before the given retry; the first retry is 1.  The returned
+// duration is randomly jittered between half and all of the exponential delay.
+func (r Retry) Backoff(retry int) time.Duration {
+	delay := r.Delay
+	for k := 1; k < retry && delay > 0; k++ {
+		delay = delay * 2
+		if r.MaxDelay > 0 && delay >= r.MaxDelay {
+			break
+		}
+	}
+	if r.MaxDelay > 0 && delay > r.MaxDelay {
+		delay = r.MaxDelay
+	}
+	if delay <= 1 {
+		return delay
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)))
+}
+
+// Do calls fn until it succeeds, fails with a non-retryable error, ctx is done, or the attempts
+// are exhausted.  fn returns the output of the command it ran so failures can be classified.
+//
+// The number of attempts made is returned along with the error from the last attempt.
+func (r Retry) Do(ctx context.Context, what string, fn func() ([]byte, error)) (int, error) {
+	var out []byte
+	var err error
+	log := r.Logger
+	if log == nil {
+		log = logger.Nil
+	}
+	attempts := r.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	//
+	for attempt := 1; ; attempt++ {
+		if out, err = fn(); err == nil {
+			if attempt > 1 {
+				log.Infof("%v succeeded on attempt %v of %v", what, attempt, attempts)
+			}
+			return attempt, nil
+		}
+		if ctx.Err() != nil {
+			return attempt, err
+		} else if !Retryable(err, out) {
+			if attempts > 1 {
+				log.Warningf("%v failed on attempt %v of %v; error is not retryable: %v", what, attempt, attempts, err)
+			}
+			return attempt, err
+		} else if attempt >= attempts {
+			if attempts > 1 {
+				log.Warningf("%v failed on attempt %v of %v; giving up: %v", what, attempt, attempts, err)
+			}
+			return attempt, err
+		}
+		//
+		wait := r.Backoff(attempt)
+		log.Warningf("%v failed on attempt %v of %v; retrying in %v: %v", what, attempt, attempts, wait.Round(time.Millisecond), err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, err
+		}
+	}
+}
+
+// Retryable returns true if err and the command output out describe a transient failure.
+//
+// pg_dump and pg_restore exit with status 1 for every failure and psql exits with status 2 for
+// every failed connection, including failed authentication and missing databases, so the output
+// of both is examined for transient connection problems.
+func Retryable(err error, out []byte) bool {
+	var exitErr *exec.ExitError
+	if err == nil {
+		return false
+	} else if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	} else if !errors.As(err, &exitErr) {
+		return false
+	}
+	//
+	switch exitErr.ExitCode() {
+	case 1, 2:
+		for _, fragment := range retryable {
+			if bytes.Contains(out, fragment) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// init seeds the random source used for jitter.
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
@@ -0,0 +1,62 @@
+package psql
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"pgbackup/script"
+)
+
+// BackupSchema returns the objects defined by the backup of DB in format.  The schema of a
+// directory backup is written as a script by pg_restore; the data in a script backup is skipped.
+func (db DB) BackupSchema(ctx context.Context, format Format) ([]script.Object, error) {
+	if format == Directory {
+		return db.schema(db.SchemaScript(ctx, db.DBName))
+	} else if db.DryRun {
+		db.Infof("read %v", filepath.Join(db.DirBackups, db.Content.Name(db.DBName)+".sql"))
+		return nil, nil
+	}
+	r, err := db.OpenScript()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return script.Schema(r)
+}
+
+// LiveSchema returns the objects defined in the database dbname as dumped by pg_dump.
+func (db DB) LiveSchema(ctx context.Context, dbname string) ([]script.Object, error) {
+	return db.schema(db.DumpSchema(ctx, dbname))
+}
+
+// schema runs cmd and returns the objects defined by the script it writes to stdout; in a dry
+// run it returns nothing.
+func (db DB) schema(cmd *exec.Cmd) ([]script.Object, error) {
+	if db.DryRun {
+		return nil, nil
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	} else if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	objects, err := script.Schema(stdout)
+	// Drain what is left so the command is not blocked writing to a full pipe.
+	io.Copy(ioutil.Discard, stdout)
+	if waitErr := cmd.Wait(); waitErr != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%v: %w: %v", filepath.Base(cmd.Path), waitErr, msg)
+		}
+		return nil, fmt.Errorf("%v: %w", filepath.Base(cmd.Path), waitErr)
+	}
+	return objects, err
+}
@@ -0,0 +1,131 @@
+package psql
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Server describes the server and pg_dump that produced a backup.
+type Server struct {
+	// Version is the result of select version().
+	Version    string `json:"version"`
+	VersionNum int    `json:"version_num"`
+	// PgDump is the output of pg_dump --version.
+	PgDump string `json:"pg_dump"`
+	// Encoding, Collate and Ctype are those of the database backed up.
+	Encoding   string      `json:"encoding"`
+	Collate    string      `json:"collate"`
+	Ctype      string      `json:"ctype"`
+	Extensions []Extension `json:"extensions,omitempty"`
+}
+
+// Extension is an extension installed in a database.
+type Extension struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Server returns the description of the server of dbname, the database itself, and pg_dump.
+func (db DB) Server(ctx context.Context, dbname string) (Server, error) {
+	var rv Server
+	out, err := db.output(db.QueryDB(ctx, dbname, `select version(), current_setting('server_version_num'),
+	pg_encoding_to_char(encoding), datcollate, datctype from pg_database where datname = current_database()`))
+	if err != nil {
+		return rv, err
+	} else if !db.DryRun {
+		fields := strings.Split(out, "|")
+		if len(fields) != 5 {
+			return rv, fmt.Errorf("unexpected server description %q", out)
+		}
+		rv.Version, rv.Encoding, rv.Collate, rv.Ctype = fields[0], fields[2], fields[3], fields[4]
+		if rv.VersionNum, err = strconv.Atoi(fields[1]); err != nil {
+			return rv, err
+		}
+	}
+	//
+	if out, err = db.output(db.QueryDB(ctx, dbname, "select extname, extversion from pg_extension order by extname")); err != nil {
+		return rv, err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if k := strings.Index(line, "|"); k > 0 {
+			rv.Extensions = append(rv.Extensions, Extension{Name: line[:k], Version: line[k+1:]})
+		}
+	}
+	//
+	if rv.PgDump, err = db.output(db.ToolVersion(ctx, "pg_dump")); err != nil {
+		return rv, err
+	}
+	return rv, nil
+}
+
+// AvailableExtensions returns the names of the extensions that can be installed on the server.
+func (db DB) AvailableExtensions(ctx context.Context) (map[string]bool, error) {
+	out, err := db.query(ctx, "select name from pg_available_extensions")
+	if err != nil {
+		return nil, err
+	}
+	rv := map[string]bool{}
+	for _, name := range strings.Split(out, "\n") {
+		if name != "" {
+			rv[name] = true
+		}
+	}
+	return rv, nil
+}
+
+// Check checks that a backup described by s can be restored into a server with the version
+// versionNum and the available extensions.  Restoring into an older major version or a server
+// without an extension the backup uses is an error; restoring into an older minor version only
+// returns a warning.  A Server without a version is never checked.
+func (s Server) Check(versionNum int, available map[string]bool) ([]string, error) {
+	var warnings []string
+	if s.VersionNum == 0 {
+		return nil, nil
+	}
+	if major(versionNum) < major(s.VersionNum) {
+		return nil, fmt.Errorf("the backup is from PostgreSQL %v but the server is %v", versionName(s.VersionNum), versionName(versionNum))
+	} else if versionNum < s.VersionNum {
+		warnings = append(warnings, fmt.Sprintf("the backup is from PostgreSQL %v but the server is %v", versionName(s.VersionNum), versionName(versionNum)))
+	}
+	var missing []string
+	for _, ext := range s.Extensions {
+		if !available[ext.Name] {
+			missing = append(missing, ext.Name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return warnings, fmt.Errorf("the server is missing extensions the backup uses: %v", strings.Join(missing, ", "))
+	}
+	return warnings, nil
+}
+
+// MajorVersion returns the major version of a server_version_num as it is written, such as 16
+// or 9.6.
+func MajorVersion(versionNum int) string {
+	if versionNum >= 100000 {
+		return fmt.Sprintf("%v", versionNum/10000)
+	}
+	return fmt.Sprintf("%v.%v", versionNum/10000, versionNum/100%100)
+}
+
+// major returns the major version of a server_version_num scaled so versions before and after
+// PostgreSQL 10 compare in order: before 10 the major version has two parts, e.g. 90600 is 9.6
+// and gives 906, while 160002 is 16 and gives 1600.
+func major(versionNum int) int {
+	if versionNum >= 100000 {
+		return versionNum / 10000 * 100
+	}
+	return versionNum / 100
+}
+
+// versionName returns the version number of a server_version_num such as 16.2 or 9.6.24.
+func versionName(versionNum int) string {
+	if versionNum >= 100000 {
+		return fmt.Sprintf("%v.%v", versionNum/10000, versionNum%10000)
+	}
+	return fmt.Sprintf("%v.%v.%v", versionNum/10000, versionNum/100%100, versionNum%100)
+}
@@ -0,0 +1,78 @@
+package psql
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Session describes a session connected to a database.
+type Session struct {
+	PID         int
+	User        string
+	Client      string
+	State       string
+	Application string
+}
+
+// String describes the session.
+func (s Session) String() string {
+	rv := fmt.Sprintf("pid %v user %v", s.PID, s.User)
+	if s.Client != "" {
+		rv = rv + " from " + s.Client
+	}
+	if s.Application != "" {
+		rv = rv + " using " + s.Application
+	}
+	if s.State != "" {
+		rv = rv + " (" + s.State + ")"
+	}
+	return rv
+}
+
+// Disconnect blocks new connections to dbname and terminates the sessions connected to it; the
+// terminated sessions are returned.  Connections remain blocked until the database is dropped
+// or they are allowed again with AllowConnections.
+func (db DB) Disconnect(ctx context.Context, dbname string) ([]Session, error) {
+	var rv []Session
+	//
+	if out, err := db.run(db.AllowConnections(ctx, dbname, false)); err != nil {
+		db.LogOutput(out)
+		return nil, fmt.Errorf("blocking connections to %v: %w", dbname, err)
+	}
+	//
+	// pg_terminate_backend is in the select list so it is only evaluated for rows that pass the
+	// where clause; its result is the first column.
+	out, err := db.query(ctx, "select concat_ws('|', pg_terminate_backend(pid), pid, usename, coalesce(host(client_addr), ''), coalesce(state, ''), application_name)"+
+		" from pg_stat_activity where datname = "+QuoteLiteral(dbname)+" and pid <> pg_backend_pid()")
+	if err != nil {
+		return nil, fmt.Errorf("terminating sessions connected to %v: %w", dbname, err)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.SplitN(line, "|", 6)
+		if len(parts) < 6 || parts[0] != "t" {
+			continue
+		}
+		pid, _ := strconv.Atoi(parts[1])
+		rv = append(rv, Session{
+			PID:         pid,
+			User:        parts[2],
+			Client:      parts[3],
+			State:       parts[4],
+			Application: parts[5],
+		})
+	}
+	return rv, nil
+}
+
+// ServerVersion returns the server_version_num of the server, e.g. 160002 for 16.2.
+func (db DB) ServerVersion(ctx context.Context) (int, error) {
+	out, err := db.query(ctx, "show server_version_num")
+	if err != nil {
+		return 0, err
+	} else if db.DryRun {
+		return 0, nil
+	}
+	return strconv.Atoi(out)
+}
@@ -0,0 +1,109 @@
+package psql
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// snapshotEnd is echoed after each query run in a Snapshot to mark the end of its output.
+const snapshotEnd = "-- pgbackup: end of output --"
+
+// Snapshot is a psql session holding a transaction whose snapshot is exported; pg_dump dumps the
+// database in the snapshot with --snapshot so queries run in the session see the rows in the
+// backup however the database changes meanwhile.
+type Snapshot struct {
+	// ID is the exported snapshot.
+	ID string
+	//
+	db     DB
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	stderr bytes.Buffer
+	wait   func() error
+}
+
+// ExportSnapshot starts a session in dbname and exports the snapshot of its transaction.  The
+// snapshot is only usable until the Snapshot is closed.
+func (db DB) ExportSnapshot(ctx context.Context, dbname string) (*Snapshot, error) {
+	var err error
+	//
+	rv := &Snapshot{db: db}
+	cmd := db.Session(ctx, dbname)
+	if !db.DryRun {
+		cmd.Stderr = &rv.stderr
+		if rv.stdin, err = cmd.StdinPipe(); err != nil {
+			return nil, err
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		} else if err = cmd.Start(); err != nil {
+			return nil, err
+		}
+		rv.stdout, rv.wait = bufio.NewReader(stdout), cmd.Wait
+	}
+	if _, err = rv.Query("begin transaction isolation level repeatable read, read only"); err != nil {
+		return nil, err
+	} else if rv.ID, err = rv.Query("select pg_export_snapshot()"); err != nil {
+		return nil, err
+	} else if rv.ID == "" && !db.DryRun {
+		rv.Close()
+		return nil, fmt.Errorf("no snapshot was exported")
+	}
+	return rv, nil
+}
+
+// Query runs sql in the transaction of the snapshot and returns its output.  A failed query ends
+// the session.
+func (s *Snapshot) Query(sql string) (string, error) {
+	if s.db.DryRun {
+		s.db.Infof("\t%v", sql)
+		return "", nil
+	}
+	if _, err := fmt.Fprintf(s.stdin, "%v;\n\\echo '%v'\n", sql, snapshotEnd); err != nil {
+		return "", s.failed(err)
+	}
+	var b strings.Builder
+	for {
+		line, err := s.stdout.ReadString('\n')
+		if err != nil {
+			return "", s.failed(err)
+		} else if strings.TrimRight(line, "\r\n") == snapshotEnd {
+			break
+		}
+		b.WriteString(line)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// Close ends the transaction and the session.
+func (s *Snapshot) Close() error {
+	if s.db.DryRun || s.wait == nil {
+		return nil
+	}
+	fmt.Fprintf(s.stdin, "commit;\n")
+	s.stdin.Close()
+	err := s.wait()
+	s.wait = nil
+	return err
+}
+
+// failed ends the session after err and returns err with the message psql wrote on stderr.
+func (s *Snapshot) failed(err error) error {
+	if s.wait != nil {
+		s.stdin.Close()
+		// The exit status of psql is kept so Retryable can classify the failure.
+		if waitErr := s.wait(); waitErr != nil {
+			err = waitErr
+		}
+		s.wait = nil
+	}
+	if msg := strings.TrimSpace(s.stderr.String()); msg != "" {
+		return fmt.Errorf("%w: %v", err, msg)
+	}
+	return err
+}
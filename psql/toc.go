@@ -0,0 +1,96 @@
+package psql
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// descs are the entry types with more than one word that pg_restore -l can print; a type that
+// is a prefix of another type comes after it so the longest match wins.
+var descs = []string{
+	"PUBLICATION TABLES IN SCHEMA",
+	"TEXT SEARCH CONFIGURATION", "TEXT SEARCH DICTIONARY", "TEXT SEARCH PARSER", "TEXT SEARCH TEMPLATE",
+	"MATERIALIZED VIEW DATA", "FOREIGN DATA WRAPPER", "DATABASE PROPERTIES", "PROCEDURAL LANGUAGE",
+	"PUBLICATION TABLE", "SEQUENCE OWNED BY", "SUBSCRIPTION TABLE", "MATERIALIZED VIEW",
+	"ACCESS METHOD", "BLOB METADATA", "CHECK CONSTRAINT", "DEFAULT ACL", "EVENT TRIGGER",
+	"FK CONSTRAINT", "FOREIGN SERVER", "FOREIGN TABLE", "INDEX ATTACH", "LARGE OBJECT",
+	"OPERATOR CLASS", "OPERATOR FAMILY", "ROW SECURITY", "SECURITY LABEL", "SEQUENCE SET",
+	"SHELL TYPE", "STATISTICS DATA", "TABLE ATTACH", "TABLE DATA", "USER MAPPING",
+}
+
+// Entry is an entry in the table of contents of an archive as printed by pg_restore -l.
+type Entry struct {
+	// ID is the dump ID of the entry.
+	ID     int    `json:"id"`
+	Type   string `json:"type"`
+	Schema string `json:"schema,omitempty"`
+	Name   string `json:"name"`
+	Owner  string `json:"owner,omitempty"`
+	// Size is the size in bytes of the entry's data when it is known.
+	Size int64 `json:"size,omitempty"`
+	// Line is the line from the listing.
+	Line string `json:"-"`
+}
+
+// TOC is the table of contents of an archive.
+type TOC []Entry
+
+// ParseTOC parses the output of pg_restore -l; comment lines beginning with ; are skipped.
+func ParseTOC(r io.Reader) (TOC, error) {
+	var rv TOC
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if entry, ok := ParseEntry(scanner.Text()); ok {
+			rv = append(rv, entry)
+		}
+	}
+	return rv, scanner.Err()
+}
+
+// ParseEntry parses a single line of the output of pg_restore -l; ok is false for comments and
+// lines that are not entries.
+//
+// Lines have the form: dumpId; tableoid oid TYPE SCHEMA NAME OWNER
+func ParseEntry(line string) (entry Entry, ok bool) {
+	entry.Line = line
+	line = strings.TrimRight(line, "\r\n")
+	k := strings.Index(line, ";")
+	if k < 0 || strings.HasPrefix(strings.TrimSpace(line), ";") {
+		return entry, false
+	}
+	var err error
+	if entry.ID, err = strconv.Atoi(strings.TrimSpace(line[:k])); err != nil {
+		return entry, false
+	}
+	// Skip the catalog tableoid and oid.
+	fields := strings.SplitN(strings.TrimLeft(line[k+1:], " "), " ", 3)
+	if len(fields) < 3 {
+		return entry, false
+	}
+	rest := fields[2]
+	entry.Type = strings.SplitN(rest, " ", 2)[0]
+	for _, desc := range descs {
+		if strings.HasPrefix(rest, desc+" ") {
+			entry.Type = desc
+			break
+		}
+	}
+	rest = strings.TrimPrefix(rest, entry.Type+" ")
+	// Schema is a single word; owner is the last word and may be empty.
+	if k = strings.Index(rest, " "); k < 0 {
+		return entry, false
+	}
+	entry.Schema, rest = rest[:k], rest[k+1:]
+	if entry.Schema == "-" {
+		entry.Schema = ""
+	}
+	if k = strings.LastIndex(rest, " "); k < 0 {
+		entry.Name = rest
+	} else {
+		entry.Name, entry.Owner = rest[:k], rest[k+1:]
+	}
+	return entry, true
+}
@@ -0,0 +1,151 @@
+package script
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxDiffCells limits the table used to diff two texts; texts whose changed lines would need a
+// larger table are diffed as a removal of one followed by an addition of the other.
+const maxDiffCells = 4 * 1024 * 1024
+
+// DiffLine is a line of a diff: Op is ' ' for a line in both texts, '-' for a line only in the
+// old text, and '+' for a line only in the new text.
+type DiffLine struct {
+	Op   byte
+	Text string
+}
+
+// Diff returns the lines of old and new as a shortest list of removals and additions that turns
+// old into new.
+func Diff(old, new []string) []DiffLine {
+	var rv []DiffLine
+	// Common lines at either end are kept out of the table.
+	start := 0
+	for start < len(old) && start < len(new) && old[start] == new[start] {
+		rv = append(rv, DiffLine{' ', old[start]})
+		start++
+	}
+	end := 0
+	for end < len(old)-start && end < len(new)-start && old[len(old)-1-end] == new[len(new)-1-end] {
+		end++
+	}
+	a, b := old[start:len(old)-end], new[start:len(new)-end]
+	//
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		for _, line := range a {
+			rv = append(rv, DiffLine{'-', line})
+		}
+		for _, line := range b {
+			rv = append(rv, DiffLine{'+', line})
+		}
+	} else {
+		// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+		lcs := make([][]int, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(a) || j < len(b) {
+			switch {
+			case i < len(a) && j < len(b) && a[i] == b[j]:
+				rv = append(rv, DiffLine{' ', a[i]})
+				i, j = i+1, j+1
+			case j == len(b) || i < len(a) && lcs[i+1][j] >= lcs[i][j+1]:
+				rv = append(rv, DiffLine{'-', a[i]})
+				i++
+			default:
+				rv = append(rv, DiffLine{'+', b[j]})
+				j++
+			}
+		}
+	}
+	for k := len(old) - end; k < len(old); k++ {
+		rv = append(rv, DiffLine{' ', old[k]})
+	}
+	return rv
+}
+
+// Unified formats a diff as the hunks of a unified diff with the given number of context lines
+// around each change; it returns nothing if there are no changes.
+func Unified(diff []DiffLine, context int) []string {
+	var rv []string
+	for k := 0; k < len(diff); {
+		if diff[k].Op == ' ' {
+			k++
+			continue
+		}
+		// A hunk runs from context lines before the first change to context lines after the
+		// last change that is no more than twice context lines from the next one.
+		first := k - context
+		if first < 0 {
+			first = 0
+		}
+		last := k
+		for n := k; n < len(diff); n++ {
+			if diff[n].Op != ' ' {
+				last = n
+			} else if n-last > 2*context {
+				break
+			}
+		}
+		end := last + context + 1
+		if end > len(diff) {
+			end = len(diff)
+		}
+		// Line numbers in the old and new texts where the hunk starts.
+		var oldAt, newAt, oldLen, newLen int
+		for _, line := range diff[:first] {
+			if line.Op != '+' {
+				oldAt++
+			}
+			if line.Op != '-' {
+				newAt++
+			}
+		}
+		var lines []string
+		for _, line := range diff[first:end] {
+			if line.Op != '+' {
+				oldLen++
+			}
+			if line.Op != '-' {
+				newLen++
+			}
+			lines = append(lines, string(line.Op)+line.Text)
+		}
+		rv = append(rv, fmt.Sprintf("@@ -%v +%v @@", hunkRange(oldAt, oldLen), hunkRange(newAt, newLen)))
+		rv = append(rv, lines...)
+		k = end
+	}
+	return rv
+}
+
+// hunkRange formats the start and length of a hunk in one text as in a unified diff.
+func hunkRange(at, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%v,0", at)
+	} else if n == 1 {
+		return fmt.Sprintf("%v", at+1)
+	}
+	return fmt.Sprintf("%v,%v", at+1, n)
+}
+
+// Lines splits text into lines without their line endings.
+func Lines(text string) []string {
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
@@ -0,0 +1,62 @@
+package script
+
+import "strings"
+
+// Header describes the object that a section of a script belongs to.  pg_dump writes a header
+// as a comment before the statements for each object:
+//
+//	-- Name: users; Type: TABLE; Schema: public; Owner: alice
+//	-- Data for Name: users; Type: TABLE DATA; Schema: public; Owner: alice
+type Header struct {
+	Name   string
+	Type   string
+	Schema string
+	Owner  string
+}
+
+// IsZero returns true for the zero Header which is used for the preamble of a script.
+func (h Header) IsZero() bool {
+	return h == Header{}
+}
+
+// IsData returns true if sections or archive entries of type typ hold data rather than
+// definitions.
+func IsData(typ string) bool {
+	return typ == "TABLE DATA" || typ == "MATERIALIZED VIEW DATA" || typ == "SEQUENCE SET" || typ == "BLOBS" || typ == "LARGE OBJECT"
+}
+
+// ParseHeader parses a header comment line; ok is false if line is not a header.
+func ParseHeader(line string) (h Header, ok bool) {
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, "-- ") {
+		return h, false
+	}
+	line = strings.TrimPrefix(line[3:], "Data for ")
+	if !strings.HasPrefix(line, "Name: ") {
+		return h, false
+	}
+	for _, field := range strings.Split(line, "; ") {
+		k := strings.Index(field, ": ")
+		if k < 0 {
+			continue
+		}
+		switch value := field[k+2:]; field[:k] {
+		case "Name":
+			h.Name = value
+		case "Type":
+			h.Type = value
+		case "Schema":
+			h.Schema = value
+		case "Owner":
+			h.Owner = value
+		}
+	}
+	// pg_dump writes - for objects without a schema or owner.
+	if h.Schema == "-" {
+		h.Schema = ""
+	}
+	if h.Owner == "-" {
+		h.Owner = ""
+	}
+	return h, h.Type != ""
+}
@@ -0,0 +1,487 @@
+package script
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Mask actions.
+const (
+	// MaskNull replaces every value of a column with NULL.
+	MaskNull = "null"
+	// MaskValue replaces every value of a column with a fixed value.
+	MaskValue = "value"
+	// MaskHash replaces each value of a column with a hash of it so equal values stay equal.
+	MaskHash = "hash"
+	// MaskEmail replaces each value of a column with a made up email address derived from a
+	// hash of it.
+	MaskEmail = "email"
+	// MaskTruncate drops all the rows of a table.
+	MaskTruncate = "truncate"
+)
+
+// MaskRule is how the data of a column or table is masked.
+type MaskRule struct {
+	// Action is one of null, value, hash, email, or truncate.
+	Action string `json:"action"`
+	// Value is the fixed value for the value action.
+	Value string `json:"value,omitempty"`
+}
+
+// Masks are rules for masking data keyed by qualified names: schema.table.column for columns and
+// schema.table for tables that are truncated.
+type Masks map[string]MaskRule
+
+// ParseMasks checks rules and returns them keyed by qualified names.  Names without a schema are
+// in public; names are matched as they are in the database so unquoted names are in lower case.
+func ParseMasks(rules map[string]MaskRule) (Masks, error) {
+	rv := Masks{}
+	for name, rule := range rules {
+		parts := strings.Split(name, ".")
+		want := 3
+		switch rule.Action {
+		case MaskTruncate:
+			want = 2
+		case MaskNull, MaskValue, MaskHash, MaskEmail:
+		default:
+			return nil, fmt.Errorf("%q: action %q: expected one of %v, %v, %v, %v, %v", name, rule.Action, MaskNull, MaskValue, MaskHash, MaskEmail, MaskTruncate)
+		}
+		if len(parts) == want-1 {
+			parts = append([]string{"public"}, parts...)
+		}
+		if len(parts) != want || strings.Contains(name, "..") || strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".") {
+			if want == 2 {
+				return nil, fmt.Errorf("%q: expected table or schema.table", name)
+			}
+			return nil, fmt.Errorf("%q: expected table.column or schema.table.column", name)
+		} else if rule.Value != "" && rule.Action != MaskValue {
+			return nil, fmt.Errorf("%q: value is only used with action %v", name, MaskValue)
+		}
+		rv[strings.Join(parts, ".")] = rule
+	}
+	return rv, nil
+}
+
+// NewMasker returns a Masker applying the masks to a single script.
+func (m Masks) NewMasker() *Masker {
+	rv := &Masker{
+		masks:   m,
+		tables:  map[string]bool{},
+		columns: map[string][]string{},
+		parents: map[string][]string{},
+	}
+	for name, rule := range m {
+		if rule.Action == MaskTruncate {
+			rv.tables[name] = true
+		} else {
+			rv.tables[name[:strings.LastIndex(name, ".")]] = true
+		}
+	}
+	return rv
+}
+
+// Masker masks the rows of INSERT statements and COPY blocks in a script.  The columns of INSERT
+// statements and COPY blocks without a column list are taken from the CREATE TABLE statement
+// earlier in the script.  The masks of a table also apply to the tables that inherit from it and
+// to its partitions.
+type Masker struct {
+	masks Masks
+	// tables holds the qualified names of the tables with masks.
+	tables map[string]bool
+	// columns holds the columns of the tables created in the script with all their columns
+	// listed; tables created with INHERITS, PARTITION OF, or OF a type are missing.
+	columns map[string][]string
+	// parents holds the tables each table inherits from or is a partition of.
+	parents map[string][]string
+	// copying holds the masks of the COPY block being read; it is nil if the block is not masked.
+	copying *tableMasks
+	err     error
+}
+
+// tableMasks are the masks of a table.
+type tableMasks struct {
+	name     string
+	truncate bool
+	// rules holds the rule for each column in the order of the rows; nil columns are kept.
+	rules []*MaskRule
+}
+
+// Err returns the first error met while masking; rows that could not be masked are dropped.
+func (m *Masker) Err() error {
+	return m.err
+}
+
+// Keep masks the data in item; it returns false if the item is dropped.  It can be passed to
+// Transform.
+func (m *Masker) Keep(item *Item) bool {
+	switch item.Kind {
+	case CopyData:
+		if m.copying == nil {
+			return true
+		} else if m.copying.truncate || m.copying.rules == nil {
+			return false
+		} else if strings.TrimRight(item.Text, "\r\n") == `\.` {
+			return true
+		}
+		item.Text = m.copying.maskRow(item.Text, m)
+		return true
+	case Statement:
+		m.copying = nil
+		switch leading(item.Text) {
+		case "CREATE":
+			m.learn(item.Text)
+		case "ALTER":
+			m.inherit(item.Text)
+		case "COPY":
+			if item.IsCopy() {
+				m.copying = m.copy(item.Text)
+				return m.copying == nil || !m.copying.truncate && m.copying.rules != nil
+			}
+		case "INSERT":
+			return m.insert(item)
+		}
+	}
+	return true
+}
+
+// fail records the first error.
+func (m *Masker) fail(format string, args ...interface{}) {
+	if m.err == nil {
+		m.err = fmt.Errorf(format, args...)
+	}
+}
+
+// table returns the masks of the table name with the given columns; it returns nil if neither
+// the table nor any table it inherits from is masked.  If the columns are needed but unknown the
+// rules are nil and an error is recorded so the rows are dropped rather than written unmasked.
+func (m *Masker) table(name string, columns []string) *tableMasks {
+	lineage := m.lineage(name)
+	masked := false
+	for _, table := range lineage {
+		masked = masked || m.tables[table]
+	}
+	if !masked {
+		return nil
+	}
+	rv := &tableMasks{name: name}
+	for _, table := range lineage {
+		if rule, ok := m.masks[table]; ok && rule.Action == MaskTruncate {
+			rv.truncate = true
+			return rv
+		}
+	}
+	if columns == nil {
+		columns = m.columns[name]
+	}
+	if columns == nil {
+		m.fail("%v is masked but its columns are unknown; the script has no column list or CREATE TABLE listing all of them", name)
+		return rv
+	}
+	rv.rules = make([]*MaskRule, len(columns))
+	for k, column := range columns {
+		// The nearest table with a rule for the column wins.
+		for _, table := range lineage {
+			if rule, ok := m.masks[table+"."+column]; ok {
+				rv.rules[k] = &rule
+				break
+			}
+		}
+	}
+	return rv
+}
+
+// lineage returns name followed by the tables it inherits from or is a partition of, nearest
+// first.
+func (m *Masker) lineage(name string) []string {
+	rv := []string{name}
+	seen := map[string]bool{name: true}
+	for k := 0; k < len(rv); k++ {
+		for _, parent := range m.parents[rv[k]] {
+			if !seen[parent] {
+				seen[parent] = true
+				rv = append(rv, parent)
+			}
+		}
+	}
+	return rv
+}
+
+// learn records the columns and parents of a table created by a CREATE TABLE statement.  The
+// columns of a table created with INHERITS, PARTITION OF, or OF a type are not all listed so they
+// are not recorded.
+func (m *Masker) learn(text string) {
+	toks := tokenize(text)
+	k := 1
+	for k < len(toks) && !toks[k].is("TABLE") {
+		// CREATE UNLOGGED TABLE and the like.
+		if toks[k].kind != 'w' || toks[k].is("AS") {
+			return
+		}
+		k++
+	}
+	if k++; k+2 < len(toks) && toks[k].is("IF") && toks[k+1].is("NOT") && toks[k+2].is("EXISTS") {
+		k += 3
+	}
+	name, k := qualified(toks, k)
+	delete(m.columns, name)
+	switch {
+	case k+1 < len(toks) && toks[k].is("PARTITION") && toks[k+1].is("OF"):
+		parent, _ := qualified(toks, k+2)
+		m.parents[name] = append(m.parents[name], parent)
+		return
+	case k >= len(toks) || toks[k].kind != '(':
+		return
+	}
+	var columns []string
+	for _, item := range split(toks, k) {
+		switch {
+		case len(item) == 0:
+		case item[0].is("CONSTRAINT"), item[0].is("PRIMARY"), item[0].is("UNIQUE"), item[0].is("CHECK"),
+			item[0].is("FOREIGN"), item[0].is("EXCLUDE"), item[0].is("LIKE"):
+		default:
+			columns = append(columns, item[0].name())
+		}
+	}
+	if k = closing(toks, k) + 1; k+1 < len(toks) && toks[k].is("INHERITS") && toks[k+1].kind == '(' {
+		for _, item := range split(toks, k+1) {
+			parent, _ := qualified(item, 0)
+			m.parents[name] = append(m.parents[name], parent)
+		}
+		return
+	}
+	m.columns[name] = columns
+}
+
+// inherit records the parent of a table attached as a partition or made to inherit by an ALTER
+// TABLE statement.
+func (m *Masker) inherit(text string) {
+	toks := tokenize(text)
+	if !hasWords(toks, "ALTER", "TABLE") {
+		return
+	}
+	k := 2
+	if k < len(toks) && toks[k].is("ONLY") {
+		k++
+	}
+	if k+1 < len(toks) && toks[k].is("IF") && toks[k+1].is("EXISTS") {
+		k += 2
+	}
+	name, k := qualified(toks, k)
+	switch {
+	case k+2 < len(toks) && toks[k].is("ATTACH") && toks[k+1].is("PARTITION"):
+		child, _ := qualified(toks, k+2)
+		m.parents[child] = append(m.parents[child], name)
+	case k+1 < len(toks) && toks[k].is("INHERIT"):
+		parent, _ := qualified(toks, k+1)
+		m.parents[name] = append(m.parents[name], parent)
+	}
+}
+
+// copy returns the masks for the COPY statement text.
+func (m *Masker) copy(text string) *tableMasks {
+	toks := tokenize(text)
+	name, k := qualified(toks, 1)
+	var columns []string
+	if k < len(toks) && toks[k].kind == '(' {
+		columns = []string{}
+		for _, item := range split(toks, k) {
+			if len(item) > 0 {
+				columns = append(columns, item[0].name())
+			}
+		}
+	}
+	return m.table(name, columns)
+}
+
+// insert masks the rows of an INSERT statement; it returns false if the statement is dropped.
+func (m *Masker) insert(item *Item) bool {
+	toks := tokenize(item.Text)
+	if len(toks) < 2 || !toks[1].is("INTO") {
+		return true
+	}
+	name, k := qualified(toks, 2)
+	var columns []string
+	if k < len(toks) && toks[k].kind == '(' {
+		columns = []string{}
+		items := split(toks, k)
+		for _, column := range items {
+			if len(column) > 0 {
+				columns = append(columns, column[0].name())
+			}
+		}
+		k = closing(toks, k) + 1
+	}
+	masks := m.table(name, columns)
+	if masks == nil {
+		return true
+	} else if masks.truncate || masks.rules == nil {
+		return false
+	}
+	for k < len(toks) && !toks[k].is("VALUES") {
+		k++
+	}
+	var b strings.Builder
+	var at int
+	for k++; k < len(toks) && toks[k].kind == '('; k++ {
+		for column, value := range split(toks, k) {
+			if column >= len(masks.rules) || masks.rules[column] == nil || len(value) == 0 {
+				continue
+			}
+			start, end := value[0].start, value[len(value)-1].end
+			b.WriteString(item.Text[at:start])
+			b.WriteString(masks.rules[column].literal(item.Text[start:end], value))
+			at = end
+		}
+		// Rows of a multi-row INSERT are separated by commas.
+		if k = closing(toks, k) + 1; k >= len(toks) || toks[k].kind != ',' {
+			break
+		}
+	}
+	b.WriteString(item.Text[at:])
+	item.Text = b.String()
+	return true
+}
+
+// maskRow masks a row of a COPY block.
+func (t *tableMasks) maskRow(line string, m *Masker) string {
+	ending := line[len(strings.TrimRight(line, "\r\n")):]
+	fields := strings.Split(strings.TrimSuffix(line, ending), "\t")
+	if len(fields) != len(t.rules) {
+		m.fail("%v: a row has %v columns where %v are expected", t.name, len(fields), len(t.rules))
+		return ""
+	}
+	for k, rule := range t.rules {
+		if rule == nil {
+			continue
+		}
+		switch {
+		case rule.Action == MaskNull:
+			fields[k] = `\N`
+		case rule.Action == MaskValue:
+			fields[k] = copyEscape(rule.Value)
+		case fields[k] != `\N`:
+			fields[k] = copyEscape(rule.mask(copyUnescape(fields[k])))
+		}
+	}
+	return strings.Join(fields, "\t") + ending
+}
+
+// literal returns the SQL literal replacing the value with the given text and tokens.
+func (r MaskRule) literal(text string, toks []token) string {
+	switch {
+	case r.Action == MaskNull:
+		return "NULL"
+	case r.Action == MaskValue:
+		return "'" + strings.ReplaceAll(r.Value, "'", "''") + "'"
+	case len(toks) == 1 && toks[0].is("NULL"):
+		return text
+	case len(toks) == 1 && toks[0].kind == '\'':
+		text = toks[0].name()
+	}
+	return "'" + strings.ReplaceAll(r.mask(text), "'", "''") + "'"
+}
+
+// mask returns the hash or email address replacing value.
+func (r MaskRule) mask(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	hash := hex.EncodeToString(sum[:16])
+	if r.Action == MaskEmail {
+		return "user_" + hash[:12] + "@example.com"
+	}
+	return hash
+}
+
+// qualified returns the possibly qualified name starting at toks[k] with public as the default
+// schema and the index of the token after it.
+func qualified(toks []token, k int) (string, int) {
+	var parts []string
+	for k < len(toks) && (toks[k].kind == 'w' || toks[k].kind == '"') {
+		parts = append(parts, toks[k].name())
+		if k+1 < len(toks) && toks[k+1].kind == '.' {
+			k += 2
+		} else {
+			k++
+			break
+		}
+	}
+	if len(parts) == 1 {
+		parts = append([]string{"public"}, parts...)
+	}
+	return strings.Join(parts, "."), k
+}
+
+// closing returns the index of the token closing the bracket at toks[k].
+func closing(toks []token, k int) int {
+	depth := 0
+	for ; k < len(toks); k++ {
+		switch toks[k].kind {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			if depth--; depth == 0 {
+				return k
+			}
+		}
+	}
+	return len(toks) - 1
+}
+
+// split returns the comma separated items inside the brackets starting at toks[k].
+func split(toks []token, k int) [][]token {
+	var rv [][]token
+	end := closing(toks, k)
+	start, depth := k+1, 0
+	for n := k + 1; n < end; n++ {
+		switch toks[n].kind {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				rv = append(rv, toks[start:n])
+				start = n + 1
+			}
+		}
+	}
+	return append(rv, toks[start:end])
+}
+
+// copyEscape escapes a value for a row of a COPY block.
+func copyEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`).Replace(value)
+}
+
+// copyUnescape returns the value of a field of a row of a COPY block.
+func copyUnescape(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+	var b strings.Builder
+	for k := 0; k < len(field); k++ {
+		if field[k] != '\\' || k+1 == len(field) {
+			b.WriteByte(field[k])
+			continue
+		}
+		k++
+		switch field[k] {
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'v':
+			b.WriteByte('\v')
+		default:
+			b.WriteByte(field[k])
+		}
+	}
+	return b.String()
+}
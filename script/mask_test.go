@@ -0,0 +1,216 @@
+package script
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMasks(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules map[string]MaskRule
+		want  []string
+		err   string
+	}{
+		{
+			name:  "default schema",
+			rules: map[string]MaskRule{"users.email": {Action: MaskEmail}, "audit": {Action: MaskTruncate}},
+			want:  []string{"public.users.email", "public.audit"},
+		},
+		{
+			name:  "qualified",
+			rules: map[string]MaskRule{"app.users.email": {Action: MaskNull}, "app.audit": {Action: MaskTruncate}},
+			want:  []string{"app.users.email", "app.audit"},
+		},
+		{
+			name:  "unknown action",
+			rules: map[string]MaskRule{"users.email": {Action: "blank"}},
+			err:   `action "blank"`,
+		},
+		{
+			name:  "column without table",
+			rules: map[string]MaskRule{"email": {Action: MaskNull}},
+			err:   "expected table.column",
+		},
+		{
+			name:  "truncate column",
+			rules: map[string]MaskRule{"app.users.email": {Action: MaskTruncate}},
+			err:   "expected table or schema.table",
+		},
+		{
+			name:  "empty part",
+			rules: map[string]MaskRule{"users..email": {Action: MaskNull}},
+			err:   "expected table.column",
+		},
+		{
+			name:  "value without value action",
+			rules: map[string]MaskRule{"users.email": {Action: MaskHash, Value: "x"}},
+			err:   "value is only used",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			masks, err := ParseMasks(test.rules)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing %q; got %v", test.err, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if len(masks) != len(test.want) {
+				t.Fatalf("expected %v masks; got %v", len(test.want), masks)
+			}
+			for _, name := range test.want {
+				if _, ok := masks[name]; !ok {
+					t.Errorf("expected %v in %v", name, masks)
+				}
+			}
+		})
+	}
+}
+
+func TestMasker(t *testing.T) {
+	hash := func(value string) string {
+		return MaskRule{Action: MaskHash}.mask(value)
+	}
+	email := func(value string) string {
+		return MaskRule{Action: MaskEmail}.mask(value)
+	}
+	rules := map[string]MaskRule{
+		"users.email":      {Action: MaskEmail},
+		"users.name":       {Action: MaskHash},
+		"users.note":       {Action: MaskNull},
+		"users.city":       {Action: MaskValue, Value: "it's\tfine"},
+		"audit":            {Action: MaskTruncate},
+		`App.Users.e-mail`: {Action: MaskNull},
+	}
+	tests := []struct {
+		name   string
+		script string
+		want   string
+		err    string
+	}{
+		{
+			name: "copy with escapes and nulls",
+			script: "COPY public.users (id, name, email, note, city) FROM stdin;\n" +
+				"1\tBob\\tJr\tbob@example.org\tsecret\tParis\n" +
+				"2\t\\N\t\\N\t\\N\t\\N\n" +
+				"\\.\n",
+			want: "COPY public.users (id, name, email, note, city) FROM stdin;\n" +
+				"1\t" + hash("Bob\tJr") + "\t" + email("bob@example.org") + "\t\\N\tit's\\tfine\n" +
+				"2\t\\N\t\\N\t\\N\tit's\\tfine\n" +
+				"\\.\n",
+		},
+		{
+			name: "copy of an unmasked table",
+			script: "COPY public.orders (id, note) FROM stdin;\n" +
+				"1\tsecret\n" +
+				"\\.\n",
+			want: "COPY public.orders (id, note) FROM stdin;\n" +
+				"1\tsecret\n" +
+				"\\.\n",
+		},
+		{
+			name: "multi-row insert",
+			script: "INSERT INTO public.users (id, name, note) VALUES (1, 'O''Brien', 'a, (b)'), (2, NULL, 'c');\n" +
+				"INSERT INTO public.orders VALUES (1, 'keep');\n",
+			want: "INSERT INTO public.users (id, name, note) VALUES (1, '" + hash("O'Brien") + "', NULL), (2, NULL, NULL);\n" +
+				"INSERT INTO public.orders VALUES (1, 'keep');\n",
+		},
+		{
+			name: "insert with columns from create table",
+			script: "CREATE TABLE public.users (\n    id integer NOT NULL,\n    email text,\n    CONSTRAINT users_pk PRIMARY KEY (id)\n);\n" +
+				"INSERT INTO public.users VALUES (1, 'a@b.c');\n",
+			want: "CREATE TABLE public.users (\n    id integer NOT NULL,\n    email text,\n    CONSTRAINT users_pk PRIMARY KEY (id)\n);\n" +
+				"INSERT INTO public.users VALUES (1, '" + email("a@b.c") + "');\n",
+		},
+		{
+			name: "quoted identifiers",
+			script: "COPY \"App\".\"Users\" (id, \"e-mail\") FROM stdin;\n" +
+				"1\ta@b.c\n" +
+				"\\.\n" +
+				"INSERT INTO \"App\".\"Users\" (\"e-mail\", id) VALUES ('a@b.c', 2);\n",
+			want: "COPY \"App\".\"Users\" (id, \"e-mail\") FROM stdin;\n" +
+				"1\t\\N\n" +
+				"\\.\n" +
+				"INSERT INTO \"App\".\"Users\" (\"e-mail\", id) VALUES (NULL, 2);\n",
+		},
+		{
+			name: "truncate",
+			script: "COPY public.audit (id) FROM stdin;\n" +
+				"1\n" +
+				"\\.\n" +
+				"INSERT INTO public.audit VALUES (2);\n" +
+				"SELECT 1;\n",
+			want: "SELECT 1;\n",
+		},
+		{
+			name: "partition",
+			script: "CREATE TABLE public.users_2024 (id integer, email text);\n" +
+				"ALTER TABLE ONLY public.users ATTACH PARTITION public.users_2024 FOR VALUES FROM (1) TO (10);\n" +
+				"INSERT INTO public.users_2024 VALUES (1, 'a@b.c');\n",
+			want: "CREATE TABLE public.users_2024 (id integer, email text);\n" +
+				"ALTER TABLE ONLY public.users ATTACH PARTITION public.users_2024 FOR VALUES FROM (1) TO (10);\n" +
+				"INSERT INTO public.users_2024 VALUES (1, '" + email("a@b.c") + "');\n",
+		},
+		{
+			name: "unknown columns",
+			script: "INSERT INTO public.users VALUES (1, 'a@b.c');\n" +
+				"SELECT 1;\n",
+			want: "SELECT 1;\n",
+			err:  "public.users is masked but its columns are unknown",
+		},
+		{
+			name: "inherited columns",
+			script: "CREATE TABLE public.vip (level integer) INHERITS (public.users);\n" +
+				"INSERT INTO public.vip VALUES (1, 'a@b.c', 1);\n",
+			want: "CREATE TABLE public.vip (level integer) INHERITS (public.users);\n",
+			err:  "public.vip is masked but its columns are unknown",
+		},
+		{
+			name: "copy row with missing columns",
+			script: "COPY public.users (id, email) FROM stdin;\n" +
+				"1\n" +
+				"\\.\n",
+			want: "COPY public.users (id, email) FROM stdin;\n" +
+				"\\.\n",
+			err: "a row has 1 columns where 2 are expected",
+		},
+	}
+	masks, err := ParseMasks(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var b strings.Builder
+			masker := masks.NewMasker()
+			if err := Transform(&b, strings.NewReader(test.script), masker.Keep); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.String(); got != test.want {
+				t.Errorf("expected\n%v\ngot\n%v", test.want, got)
+			}
+			switch err := masker.Err(); {
+			case test.err == "" && err != nil:
+				t.Errorf("unexpected error %v", err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Errorf("expected error containing %q; got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestCopyEscape(t *testing.T) {
+	tests := []string{"plain", "tab\there", "new\nline", `back\slash`, "cr\rlf", ""}
+	for _, value := range tests {
+		if got := copyUnescape(copyEscape(value)); got != value {
+			t.Errorf("expected %q; got %q", value, got)
+		}
+	}
+	if got := copyUnescape(`a\bb\fc\vd\\e`); got != "a\bb\fc\vd\\e" {
+		t.Errorf("unexpected %q", got)
+	}
+}
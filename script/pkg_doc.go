@@ -0,0 +1,2 @@
+// Package script reads and rewrites the SQL scripts written by pg_dump.
+package script
@@ -0,0 +1,235 @@
+package script
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Kind identifies the kind of an Item.
+type Kind int
+
+const (
+	// Comment is a run of comment and blank lines between statements.
+	Comment Kind = iota
+	// Statement is a single SQL statement.
+	Statement
+	// Meta is a psql meta-command such as \connect.
+	Meta
+	// CopyData is a row of data following a COPY ... FROM stdin statement; the terminating
+	// \. line is also CopyData.
+	CopyData
+)
+
+// Item is a piece of a script.
+type Item struct {
+	Kind Kind
+	// Header is the header of the section the item belongs to; it is the zero Header for the
+	// preamble before the first section.
+	Header Header
+	// Text is the raw text of the item including line endings.
+	Text string
+}
+
+// IsSetting returns true if the item is a statement that changes a session setting, such as
+// the SET statements pg_dump writes at the top of a script and between sections.
+func (item Item) IsSetting() bool {
+	if item.Kind != Statement {
+		return false
+	}
+	text := strings.ToUpper(strings.TrimSpace(item.Text))
+	return strings.HasPrefix(text, "SET ") || strings.HasPrefix(text, "SELECT PG_CATALOG.SET_CONFIG(")
+}
+
+// IsCopy returns true if the item is a COPY ... FROM stdin statement whose rows follow as
+// CopyData items.
+func (item Item) IsCopy() bool {
+	if item.Kind != Statement {
+		return false
+	}
+	text := strings.TrimSpace(item.Text)
+	return len(text) > 5 && strings.EqualFold(text[:5], "COPY ") && strings.HasSuffix(strings.ToLower(text), "from stdin;")
+}
+
+// Reader reads the items of a script.
+type Reader struct {
+	rd     *bufio.Reader
+	header Header
+	// pending holds a line read ahead that starts the next item.
+	pending string
+	copying bool
+	err     error
+}
+
+// NewReader returns a Reader reading the script from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{rd: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// Next returns the next item in the script; at the end of the script it returns io.EOF.
+func (r *Reader) Next() (Item, error) {
+	line, err := r.line()
+	if err != nil {
+		return Item{}, err
+	}
+	//
+	if r.copying {
+		if strings.TrimRight(line, "\r\n") == `\.` {
+			r.copying = false
+		}
+		return Item{Kind: CopyData, Header: r.header, Text: line}, nil
+	}
+	//
+	trimmed := strings.TrimSpace(line)
+	switch {
+	case trimmed == "" || strings.HasPrefix(trimmed, "--"):
+		return r.comment(line)
+	case strings.HasPrefix(trimmed, `\`):
+		return Item{Kind: Meta, Header: r.header, Text: line}, nil
+	}
+	//
+	var b strings.Builder
+	var lex lexer
+	for {
+		b.WriteString(line)
+		if lex.scan(line) {
+			break
+		}
+		if line, err = r.line(); err == io.EOF {
+			break
+		} else if err != nil {
+			return Item{}, err
+		}
+	}
+	item := Item{Kind: Statement, Header: r.header, Text: b.String()}
+	r.copying = item.IsCopy()
+	return item, nil
+}
+
+// comment collects a run of comment and blank lines starting with line into one item.  A header
+// within the run starts a new section and the run belongs to it.
+func (r *Reader) comment(line string) (Item, error) {
+	var b strings.Builder
+	for {
+		if h, ok := ParseHeader(line); ok {
+			r.header = h
+		}
+		b.WriteString(line)
+		next, err := r.line()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return Item{}, err
+		}
+		if trimmed := strings.TrimSpace(next); trimmed != "" && !strings.HasPrefix(trimmed, "--") {
+			r.pending = next
+			break
+		}
+		line = next
+	}
+	return Item{Kind: Comment, Header: r.header, Text: b.String()}, nil
+}
+
+// line returns the next line including its line ending.
+func (r *Reader) line() (string, error) {
+	if r.pending != "" {
+		line := r.pending
+		r.pending = ""
+		return line, nil
+	} else if r.err != nil {
+		return "", r.err
+	}
+	line, err := r.rd.ReadString('\n')
+	if err != nil {
+		r.err = err
+		if line == "" {
+			return "", err
+		}
+	}
+	return line, nil
+}
+
+// lexer tracks quoting across the lines of a statement.
+type lexer struct {
+	// quote is the open quote character, if any: ' or ".
+	quote byte
+	// escapes is true inside an E'' string where backslash escapes the next character.
+	escapes bool
+	// dollar is the tag of the open dollar quote including both $; empty if none.
+	dollar string
+	// comments is the depth of nested /* */ comments.
+	comments int
+	// ended is true if a ; has been seen with nothing significant after it.
+	ended bool
+}
+
+// scan scans a line of a statement and returns true if the statement ends with it.
+func (l *lexer) scan(line string) bool {
+	for k := 0; k < len(line); k++ {
+		c := line[k]
+		switch {
+		case l.comments > 0:
+			if c == '*' && k+1 < len(line) && line[k+1] == '/' {
+				l.comments--
+				k++
+			} else if c == '/' && k+1 < len(line) && line[k+1] == '*' {
+				l.comments++
+				k++
+			}
+		case l.dollar != "":
+			if c == '$' && strings.HasPrefix(line[k:], l.dollar) {
+				k += len(l.dollar) - 1
+				l.dollar = ""
+			}
+		case l.quote != 0:
+			if l.escapes && c == '\\' {
+				k++
+			} else if c == l.quote {
+				if k+1 < len(line) && line[k+1] == l.quote {
+					k++
+				} else {
+					l.quote, l.escapes = 0, false
+				}
+			}
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+		case c == '-' && k+1 < len(line) && line[k+1] == '-':
+			k = len(line)
+		case c == '/' && k+1 < len(line) && line[k+1] == '*':
+			l.comments++
+			k++
+		case c == '\'' || c == '"':
+			l.quote, l.ended = c, false
+			l.escapes = c == '\'' && k > 0 && (line[k-1] == 'E' || line[k-1] == 'e') && (k == 1 || !isIdent(line[k-2]))
+		case c == '$' && (k == 0 || !isIdent(line[k-1])):
+			l.ended = false
+			if tag := dollarTag(line[k:]); tag != "" {
+				l.dollar = tag
+				k += len(tag) - 1
+			}
+		case c == ';':
+			l.ended = true
+		default:
+			l.ended = false
+		}
+	}
+	return l.ended && l.quote == 0 && l.dollar == "" && l.comments == 0
+}
+
+// dollarTag returns the dollar quote tag at the start of s, such as $$ or $body$, or an empty
+// string if s does not start with one.
+func dollarTag(s string) string {
+	for k := 1; k < len(s); k++ {
+		c := s[k]
+		if c == '$' {
+			return s[:k+1]
+		} else if !isIdent(c) || (k == 1 && c >= '0' && c <= '9') {
+			return ""
+		}
+	}
+	return ""
+}
+
+// isIdent returns true if c can appear in an unquoted identifier.
+func isIdent(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
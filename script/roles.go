@@ -0,0 +1,253 @@
+package script
+
+import (
+	"strings"
+)
+
+// IsOwner returns true if the item is a statement that sets the owner of an object, such as the
+// ALTER ... OWNER TO statements pg_dump writes after creating objects.
+func (item Item) IsOwner() bool {
+	if item.Kind != Statement {
+		return false
+	} else if word := leading(item.Text); word != "ALTER" && word != "SET" {
+		return false
+	}
+	toks := tokenize(item.Text)
+	switch {
+	case hasWords(toks, "SET", "SESSION", "AUTHORIZATION"):
+		return true
+	case hasWords(toks, "ALTER"):
+		for k := 1; k+1 < len(toks); k++ {
+			if toks[k].is("OWNER") && toks[k+1].is("TO") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsPrivilege returns true if the item is a statement that grants or revokes privileges.
+func (item Item) IsPrivilege() bool {
+	if item.Kind != Statement {
+		return false
+	} else if item.Header.Type == "ACL" || item.Header.Type == "DEFAULT ACL" {
+		return true
+	}
+	switch leading(item.Text) {
+	case "GRANT", "REVOKE":
+		return true
+	case "ALTER":
+		return hasWords(tokenize(item.Text), "ALTER", "DEFAULT", "PRIVILEGES")
+	}
+	return false
+}
+
+// MapRoles returns the statement text with the roles named in roles replaced by the roles they
+// map to.  Roles are replaced where they appear as owners and grantees:
+//
+//	ALTER ... OWNER TO role
+//	GRANT ... TO role and REVOKE ... FROM role including GRANTED BY role
+//	ALTER DEFAULT PRIVILEGES FOR ROLE role ... TO role
+//	CREATE SCHEMA ... AUTHORIZATION role and CREATE POLICY ... TO role
+//	SET SESSION AUTHORIZATION role
+//
+// Names of other objects are never changed.  Unquoted names in the statement are matched in
+// lower case as Postgres folds them.
+func MapRoles(text string, roles map[string]string) string {
+	var b strings.Builder
+	var at int
+	var expect bool
+	//
+	if len(roles) == 0 {
+		return text
+	}
+	switch leading(text) {
+	case "GRANT", "REVOKE", "ALTER", "CREATE", "SET":
+	default:
+		return text
+	}
+	toks := tokenize(text)
+	// triggers returns true if the role list starts after the token at k.
+	var triggers func(k int) bool
+	switch {
+	case hasWords(toks, "GRANT"), hasWords(toks, "REVOKE"):
+		triggers = func(k int) bool {
+			return toks[k].is("TO") || toks[k].is("FROM") || toks[k].is("BY") && toks[k-1].is("GRANTED")
+		}
+	case hasWords(toks, "ALTER", "DEFAULT", "PRIVILEGES"):
+		triggers = func(k int) bool {
+			return toks[k].is("TO") || toks[k].is("FROM") || (toks[k].is("ROLE") || toks[k].is("USER")) && toks[k-1].is("FOR")
+		}
+	case hasWords(toks, "ALTER"):
+		triggers = func(k int) bool {
+			return toks[k].is("TO") && toks[k-1].is("OWNER")
+		}
+	case hasWords(toks, "CREATE", "SCHEMA"):
+		triggers = func(k int) bool {
+			return toks[k].is("AUTHORIZATION")
+		}
+	case hasWords(toks, "CREATE", "POLICY"):
+		triggers = func(k int) bool {
+			return toks[k].is("TO")
+		}
+	case hasWords(toks, "SET", "SESSION", "AUTHORIZATION"):
+		triggers = func(k int) bool {
+			return k == 2
+		}
+	default:
+		return text
+	}
+	//
+	for k := 1; k < len(toks); k++ {
+		tok := toks[k]
+		if !expect {
+			expect = triggers(k)
+			continue
+		}
+		switch {
+		case tok.is("GROUP"):
+			continue
+		case tok.kind == ',':
+			continue
+		case tok.kind == 'w' || tok.kind == '"' || tok.kind == '\'':
+			if to, ok := roles[tok.name()]; ok && !(tok.kind == 'w' && tok.is("PUBLIC")) {
+				b.WriteString(text[at:tok.start])
+				if tok.kind == '\'' {
+					b.WriteString("'" + strings.ReplaceAll(to, "'", "''") + "'")
+				} else {
+					b.WriteString(`"` + strings.ReplaceAll(to, `"`, `""`) + `"`)
+				}
+				at = tok.end
+			}
+			// A role list continues only after a comma.
+			if k+1 < len(toks) && toks[k+1].kind == ',' {
+				continue
+			}
+		}
+		expect = false
+	}
+	b.WriteString(text[at:])
+	return b.String()
+}
+
+// token is a token of a statement.
+type token struct {
+	// kind is 'w' for a word, '"' for a quoted identifier, '\'' for a string, '$' for a dollar
+	// quoted string, or the punctuation character itself.
+	kind       byte
+	start, end int
+	text       string
+}
+
+// is returns true if the token is the unquoted word.
+func (t token) is(word string) bool {
+	return t.kind == 'w' && strings.EqualFold(t.text, word)
+}
+
+// name returns the name the token refers to: unquoted words are folded to lower case and quoted
+// identifiers and strings are unquoted.
+func (t token) name() string {
+	switch t.kind {
+	case 'w':
+		return strings.ToLower(t.text)
+	case '"':
+		return strings.ReplaceAll(t.text[1:len(t.text)-1], `""`, `"`)
+	case '\'':
+		return strings.ReplaceAll(t.text[1:len(t.text)-1], `''`, `'`)
+	}
+	return t.text
+}
+
+// hasWords returns true if the statement starts with the words.
+func hasWords(toks []token, words ...string) bool {
+	if len(toks) < len(words) {
+		return false
+	}
+	for k, word := range words {
+		if !toks[k].is(word) {
+			return false
+		}
+	}
+	return true
+}
+
+// leading returns the first word of the statement text in upper case; it is a cheap test that
+// avoids tokenizing statements such as INSERTs that can never name roles.
+func leading(text string) string {
+	text = strings.TrimLeft(text, " \t\r\n")
+	k := 0
+	for k < len(text) && (text[k] >= 'a' && text[k] <= 'z' || text[k] >= 'A' && text[k] <= 'Z') {
+		k++
+	}
+	return strings.ToUpper(text[:k])
+}
+
+// tokenize splits statement text into tokens; comments and white space are dropped.
+func tokenize(text string) []token {
+	var rv []token
+	for k := 0; k < len(text); {
+		c := text[k]
+		start := k
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			k++
+			continue
+		case c == '-' && strings.HasPrefix(text[k:], "--"):
+			if n := strings.IndexByte(text[k:], '\n'); n >= 0 {
+				k += n + 1
+			} else {
+				k = len(text)
+			}
+			continue
+		case c == '/' && strings.HasPrefix(text[k:], "/*"):
+			for depth := 0; k < len(text); k++ {
+				if strings.HasPrefix(text[k:], "/*") {
+					depth, k = depth+1, k+1
+				} else if strings.HasPrefix(text[k:], "*/") {
+					if depth, k = depth-1, k+1; depth == 0 {
+						k++
+						break
+					}
+				}
+			}
+			continue
+		case c == '\'' || c == '"':
+			escapes := c == '\'' && len(rv) > 0 && rv[len(rv)-1].end == k && (rv[len(rv)-1].text == "E" || rv[len(rv)-1].text == "e")
+			for k++; k < len(text); k++ {
+				if escapes && text[k] == '\\' {
+					k++
+				} else if text[k] == c {
+					if k+1 < len(text) && text[k+1] == c {
+						k++
+					} else {
+						break
+					}
+				}
+			}
+			k++
+			if k > len(text) {
+				k = len(text)
+			}
+			rv = append(rv, token{kind: c, start: start, end: k, text: text[start:k]})
+			continue
+		case c == '$' && dollarTag(text[k:]) != "":
+			tag := dollarTag(text[k:])
+			if n := strings.Index(text[k+len(tag):], tag); n >= 0 {
+				k += len(tag) + n + len(tag)
+			} else {
+				k = len(text)
+			}
+			rv = append(rv, token{kind: '$', start: start, end: k, text: text[start:k]})
+			continue
+		case isIdent(c):
+			for k < len(text) && (isIdent(text[k]) || text[k] == '$') {
+				k++
+			}
+			rv = append(rv, token{kind: 'w', start: start, end: k, text: text[start:k]})
+			continue
+		}
+		k++
+		rv = append(rv, token{kind: c, start: start, end: k, text: text[start:k]})
+	}
+	return rv
+}
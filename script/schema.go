@@ -0,0 +1,77 @@
+package script
+
+import (
+	"io"
+	"sort"
+	"strings"
+)
+
+// Object is the normalized definition of an object in a schema script.
+type Object struct {
+	Header Header
+	// Text holds the statements that define the object without comments and blank lines; lines
+	// have trailing white space removed.
+	Text string
+}
+
+// Key returns the type and qualified name that identify the object.
+func (o Object) Key() string {
+	return o.Header.Type + " " + o.Name()
+}
+
+// Name returns the name of the object qualified with its schema if it has one.
+func (o Object) Name() string {
+	if o.Header.Schema != "" {
+		return o.Header.Schema + "." + o.Header.Name
+	}
+	return o.Header.Name
+}
+
+// Schema reads a script written by pg_dump and returns the objects it defines sorted by type and
+// name.  Data sections, settings, comments, and psql meta-commands are dropped so scripts dumped
+// at different times by different versions of pg_dump can be compared.
+func Schema(r io.Reader) ([]Object, error) {
+	var keys []string
+	objects := map[string]*Object{}
+	rd := NewReader(r)
+	for {
+		item, err := rd.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if item.Kind != Statement || item.IsSetting() || item.Header.IsZero() || IsData(item.Header.Type) {
+			continue
+		}
+		object := Object{Header: item.Header}
+		object.Header.Owner = ""
+		key := object.Key()
+		if objects[key] == nil {
+			keys = append(keys, key)
+			objects[key] = &object
+		}
+		objects[key].Text += normalize(item.Text)
+	}
+	sort.Strings(keys)
+	rv := make([]Object, 0, len(keys))
+	for _, key := range keys {
+		rv = append(rv, *objects[key])
+	}
+	return rv, nil
+}
+
+// normalize removes trailing white space, blank lines, and whole line comments from the text of a
+// statement.
+func normalize(text string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if trimmed := strings.TrimSpace(line); trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,28 @@
+package script
+
+import (
+	"bufio"
+	"io"
+)
+
+// Transform copies the script read from r to w passing each item to fn first.  fn may change
+// the text of the item; items for which fn returns false are dropped.
+func Transform(w io.Writer, r io.Reader, fn func(item *Item) bool) error {
+	rd := NewReader(r)
+	wr := bufio.NewWriterSize(w, 64*1024)
+	for {
+		item, err := rd.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if fn != nil && !fn(&item) {
+			continue
+		}
+		if _, err = wr.WriteString(item.Text); err != nil {
+			return err
+		}
+	}
+	return wr.Flush()
+}